@@ -0,0 +1,120 @@
+// Package bar renders the tracked windows for status bars: waybar custom
+// modules and polybar script modules.
+package bar
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hellola/startorswitch/manager"
+)
+
+// Item is a tracked window shown in the bar
+type Item struct {
+	Name  string
+	State manager.WindowState
+}
+
+// Items returns the tracked windows known to state in the order of its
+// Windows, by name
+func Items(state manager.StateManagement) []Item {
+	var items []Item
+	for _, record := range state.Windows() {
+		if record.ID != "" {
+			items = append(items, Item{Name: record.Name, State: record.State})
+		}
+	}
+	return items
+}
+
+// Only returns the item called name, or none if it isn't tracked. A waybar
+// module per window renders only its own item so each module's on-click
+// can toggle that window.
+func Only(items []Item, name string) []Item {
+	for _, item := range items {
+		if item.Name == name {
+			return []Item{item}
+		}
+	}
+	return nil
+}
+
+// Format controls how items are rendered
+type Format struct {
+	// Visible and Hidden are fmt patterns applied to the window name
+	Visible string
+	Hidden  string
+	// Command is run with "focus <name>" to toggle a window on click
+	Command string
+}
+
+// DefaultFormat shows hidden windows in parentheses
+var DefaultFormat = Format{
+	Visible: "%s",
+	Hidden:  "(%s)",
+	Command: "startorswitch",
+}
+
+func (f Format) label(item Item) string {
+	if item.State == manager.NotVisible {
+		return fmt.Sprintf(f.Hidden, item.Name)
+	}
+	return fmt.Sprintf(f.Visible, item.Name)
+}
+
+// waybarOutput is the JSON a waybar custom module with "return-type": "json"
+// reads, one object per line
+type waybarOutput struct {
+	Text    string   `json:"text"`
+	Tooltip string   `json:"tooltip"`
+	Class   []string `json:"class"`
+}
+
+// Waybar renders items as a waybar custom module line. The class is
+// "empty" without tracked windows, otherwise "visible" and/or "hidden"
+// depending on the windows' states. Waybar cannot attach actions to parts of
+// the text, so a clickable window gets a module of its own rendering Only
+// its item, with on-click bound to "focus <name>".
+func Waybar(items []Item, format Format) ([]byte, error) {
+	out := waybarOutput{Class: []string{}}
+	var labels, tooltip []string
+	var visible, hidden bool
+	for _, item := range items {
+		labels = append(labels, format.label(item))
+		tooltip = append(tooltip, fmt.Sprintf("%s: %s", item.Name, item.State))
+		if item.State == manager.NotVisible {
+			hidden = true
+		} else {
+			visible = true
+		}
+	}
+	out.Text = strings.Join(labels, " ")
+	out.Tooltip = strings.Join(tooltip, "\n")
+	if visible {
+		out.Class = append(out.Class, "visible")
+	}
+	if hidden {
+		out.Class = append(out.Class, "hidden")
+	}
+	if len(items) == 0 {
+		out.Class = append(out.Class, "empty")
+	}
+	return json.Marshal(out)
+}
+
+// Polybar renders items as a polybar formatted line where clicking a window
+// toggles it
+func Polybar(items []Item, format Format) string {
+	labels := make([]string, len(items))
+	for i, item := range items {
+		action := polybarEscape(fmt.Sprintf("%s focus %s", format.Command, item.Name))
+		labels[i] = fmt.Sprintf("%%{A1:%s:}%s%%{A}", action, format.label(item))
+	}
+	return strings.Join(labels, " ")
+}
+
+// polybarEscape escapes the colons that would end an action tag
+func polybarEscape(s string) string {
+	return strings.ReplaceAll(s, ":", "\\:")
+}
@@ -0,0 +1,78 @@
+package bar
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hellola/startorswitch/manager"
+)
+
+func testItems() []Item {
+	return []Item{
+		{Name: "notes", State: manager.NotVisible},
+		{Name: "term", State: manager.Visible},
+	}
+}
+
+func TestItems(t *testing.T) {
+	state := manager.NewMemoryStateManagement()
+	state.StoreID("term", "0x01")
+	state.SetState("term", manager.Visible)
+	state.StoreID("notes", "0x02")
+	state.SetState("notes", manager.NotVisible)
+	state.StorePrevID("0x01")
+
+	if got := Items(state); !reflect.DeepEqual(got, testItems()) {
+		t.Errorf("Items() = %v, want %v", got, testItems())
+	}
+}
+
+func TestOnly(t *testing.T) {
+	if got := Only(testItems(), "term"); !reflect.DeepEqual(got, testItems()[1:]) {
+		t.Errorf("Only(term) = %v, want [term]", got)
+	}
+	if got := Only(testItems(), "mail"); len(got) != 0 {
+		t.Errorf("Only(mail) = %v, want none", got)
+	}
+}
+
+func TestWaybar(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []Item
+		want  string
+	}{
+		{
+			name:  "tracked windows",
+			items: testItems(),
+			want:  `{"text":"(notes) term","tooltip":"notes: hidden\nterm: visible","class":["visible","hidden"]}`,
+		},
+		{
+			name: "nothing tracked",
+			want: `{"text":"","tooltip":"","class":["empty"]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Waybar(tt.items, DefaultFormat)
+			if err != nil {
+				t.Fatalf("Waybar() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Waybar() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolybar(t *testing.T) {
+	format := DefaultFormat
+	format.Command = "env FOO=a:b startorswitch"
+	format.Hidden = "%%{F#666}%s%%{F-}"
+
+	want := `%{A1:env FOO=a\:b startorswitch focus notes:}%{F#666}notes%{F-}%{A} ` +
+		`%{A1:env FOO=a\:b startorswitch focus term:}term%{A}`
+	if got := Polybar(testItems(), format); got != want {
+		t.Errorf("Polybar() = %s, want %s", got, want)
+	}
+}
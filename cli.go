@@ -0,0 +1,597 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hellola/startorswitch/bar"
+	"github.com/hellola/startorswitch/config"
+	"github.com/hellola/startorswitch/daemon"
+	"github.com/hellola/startorswitch/manager"
+)
+
+// Exit codes
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// usageError reports a command line that could not be understood, as
+// opposed to a command that failed
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+func usagef(format string, args ...interface{}) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// globals holds the flags every command accepts
+type globals struct {
+	verbose  bool
+	noDaemon bool
+	session  string
+}
+
+// command is a subcommand of the CLI
+type command struct {
+	name    string
+	aliases []string
+	args    string
+	summary string
+	// setup registers the command's flags and returns the function running
+	// it with the positional arguments left after flag parsing
+	setup func(fs *flag.FlagSet, g *globals) func(args []string) error
+}
+
+// commands lists the subcommands in the order they are shown in the help
+var commands = []*command{
+	{
+		name:    "focus",
+		aliases: []string{"f"},
+		args:    "<name>",
+		summary: "Track the focused window as <name>, or toggle it if already tracked",
+		setup:   toggleCommand("focus"),
+	},
+	{
+		name:    "app",
+		aliases: []string{"a", "application"},
+		args:    "<name>",
+		summary: "Toggle the window of application <name>, starting it if needed",
+		setup:   toggleCommand("application"),
+	},
+	{
+		name:    "clean",
+		aliases: []string{"c"},
+		args:    "<name>",
+		summary: "Stop tracking <name>",
+		setup:   nameCommand("clean"),
+	},
+	{
+		name:    "show",
+		args:    "<name>",
+		summary: "Show the tracked window <name> if it is hidden",
+		setup:   nameCommand("show"),
+	},
+	{
+		name:    "hide",
+		aliases: []string{"h"},
+		summary: "Hide the focused window if it is tracked",
+		setup:   simpleCommand("hide"),
+	},
+	{
+		name:    "toggle-latest",
+		aliases: []string{"hl", "hide-latest"},
+		summary: "Toggle the most recently shown window",
+		setup:   simpleCommand("hide-latest"),
+	},
+	{
+		name:    "next",
+		summary: "Hide the current tracked window and show the next one, most recent first",
+		setup:   cycleCommand("next"),
+	},
+	{
+		name:    "prev",
+		summary: "Hide the current tracked window and show the previous one",
+		setup:   cycleCommand("prev"),
+	},
+	{
+		name:    "hide-all",
+		aliases: []string{"ha"},
+		summary: "Hide all tracked windows",
+		setup:   simpleCommand("hide-all"),
+	},
+	{
+		name:    "show-all",
+		aliases: []string{"s"},
+		summary: "Show all hidden windows",
+		setup:   simpleCommand("show-all"),
+	},
+	{
+		name:    "group-show",
+		args:    "<group>",
+		summary: "Show every hidden window in <group>",
+		setup:   nameCommand("group-show"),
+	},
+	{
+		name:    "group-hide",
+		args:    "<group>",
+		summary: "Hide every visible window in <group>",
+		setup:   nameCommand("group-hide"),
+	},
+	{
+		name:    "group-toggle",
+		aliases: []string{"g"},
+		args:    "<group>",
+		summary: "Hide <group> if any of its windows is visible, show it otherwise",
+		setup:   nameCommand("group-toggle"),
+	},
+	{
+		name:    "reset",
+		aliases: []string{"r"},
+		summary: "Forget all tracked windows",
+		setup:   simpleCommand("reset"),
+	},
+	{
+		name:    "pick",
+		summary: "Choose a tracked window with rofi, dmenu or similar and act on it",
+		setup:   pickCommand,
+	},
+	{
+		name:    "status",
+		aliases: []string{"list", "ls"},
+		summary: "Show the tracked windows",
+		setup:   statusCommand,
+	},
+	{
+		name:    "bar",
+		summary: "Print the tracked windows for waybar or polybar",
+		setup:   barCommand,
+	},
+	{
+		name:    "daemon",
+		summary: "Serve commands on a unix socket, keeping state and WM connections open",
+		setup:   noArgs(runDaemon),
+	},
+	{
+		name:    "watch",
+		summary: "Keep the state in sync with window manager events",
+		setup:   noArgs(runWatch),
+	},
+}
+
+// lookup finds a command by name or alias
+func lookup(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+		for _, alias := range cmd.aliases {
+			if alias == name {
+				return cmd
+			}
+		}
+	}
+	return nil
+}
+
+// run executes the command line and returns the exit code
+func run(args []string, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return exitUsage
+	}
+	name, args := args[0], args[1:]
+	switch name {
+	case "help", "-h", "-help", "--help":
+		if len(args) == 0 {
+			usage(stderr)
+			return exitOK
+		}
+		cmd := lookup(args[0])
+		if cmd == nil {
+			fmt.Fprintf(stderr, "Error: unknown command: %s\n", args[0])
+			return exitUsage
+		}
+		fs, _, _ := cmd.flagSet(stderr)
+		fs.Usage()
+		return exitOK
+	}
+
+	cmd := lookup(name)
+	if cmd == nil {
+		fmt.Fprintf(stderr, "Error: unknown command: %s\n", name)
+		usage(stderr)
+		return exitUsage
+	}
+	fs, g, exec := cmd.flagSet(stderr)
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	// Set up logging based on verbose flag
+	if g.verbose {
+		log.SetOutput(os.Stderr)
+	} else {
+		log.SetOutput(&DiscardWriter{})
+	}
+
+	err = exec(positional)
+	var uerr *usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &uerr):
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		fs.Usage()
+		return exitUsage
+	default:
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return exitError
+	}
+}
+
+// flagSet creates the flag set of cmd with the global flags and the
+// command's own flags registered
+func (cmd *command) flagSet(stderr io.Writer) (*flag.FlagSet, *globals, func(args []string) error) {
+	g := &globals{}
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.BoolVar(&g.verbose, "verbose", false, "Enable verbose logging")
+	fs.BoolVar(&g.noDaemon, "no-daemon", false, "Execute the command in process even if a daemon is running")
+	fs.StringVar(&g.session, "session", "", "Session whose windows to act on, detected from the environment by default")
+	fs.Usage = func() {
+		synopsis := "startorswitch " + cmd.name + " [flags]"
+		if cmd.args != "" {
+			synopsis += " " + cmd.args
+		}
+		fmt.Fprintf(stderr, "Usage: %s\n\n%s\n", synopsis, cmd.summary)
+		if len(cmd.aliases) > 0 {
+			fmt.Fprintf(stderr, "\nAliases: %s\n", strings.Join(cmd.aliases, ", "))
+		}
+		fmt.Fprintf(stderr, "\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	return fs, g, cmd.setup(fs, g)
+}
+
+// optionalBool is a boolean flag that remembers whether it was given, so
+// "-exclusive=false" can override a config default of true
+type optionalBool struct {
+	set   bool
+	value bool
+}
+
+func (b *optionalBool) String() string {
+	if b == nil || !b.set {
+		return ""
+	}
+	return strconv.FormatBool(b.value)
+}
+
+func (b *optionalBool) Set(s string) error {
+	value, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	b.set, b.value = true, value
+	return nil
+}
+
+func (b *optionalBool) IsBoolFlag() bool {
+	return true
+}
+
+// parseInterspersed parses args allowing flags after positional arguments,
+// so both "focus -switch-to term" and "focus term -switch-to" work
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// usage prints the list of commands
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: startorswitch <command> [flags] [args]\n\nCommands:\n")
+	for _, cmd := range commands {
+		names := strings.Join(append([]string{cmd.name}, cmd.aliases...), ", ")
+		if cmd.args != "" {
+			names += " " + cmd.args
+		}
+		fmt.Fprintf(w, "  %-38s %s\n", names, cmd.summary)
+	}
+	fmt.Fprintf(w, "\nRun 'startorswitch help <command>' for the flags of a command.\n")
+}
+
+// toggleCommand is a manager command on a named window that accepts the
+// toggle options
+func toggleCommand(mode string) func(fs *flag.FlagSet, g *globals) func(args []string) error {
+	return func(fs *flag.FlagSet, g *globals) func(args []string) error {
+		switchTo := fs.Bool("switch-to", false, "Focus the window instead of hiding it when it is visible but not focused")
+		topPadding := fs.Int("top-padding", 0, "Top padding of the focused monitor while the window is hidden")
+		sticky := fs.Bool("sticky", false, "Make the window sticky, short for -mods sticky")
+		mods := fs.String("mods", "", "Comma separated modifiers to switch on: sticky, floating, above, fullscreen")
+		group := fs.String("group", "", "Add the window to these comma separated groups")
+		var exclusive optionalBool
+		fs.Var(&exclusive, "exclusive", "Hide the other tracked windows when showing this one, overriding the config")
+		var follow optionalBool
+		fs.Var(&follow, "follow", "Switch to the window's desktop instead of bringing it to the focused one, overriding the config")
+		return func(args []string) error {
+			name, err := nameArg(args)
+			if err != nil {
+				return err
+			}
+			options := make(map[string]string)
+			if *switchTo {
+				options["switch_to"] = "true"
+			}
+			if *topPadding != 0 {
+				options["top_padding"] = strconv.Itoa(*topPadding)
+			}
+			var modifiers []string
+			if *mods != "" {
+				modifiers = strings.Split(*mods, ",")
+			}
+			if *sticky {
+				modifiers = append(modifiers, "sticky")
+			}
+			if len(modifiers) > 0 {
+				options["mods"] = strings.Join(modifiers, ",")
+			}
+			if *group != "" {
+				options["group"] = *group
+			}
+			if exclusive.set {
+				options["exclusive"] = strconv.FormatBool(exclusive.value)
+			}
+			if follow.set {
+				options["follow"] = strconv.FormatBool(follow.value)
+			}
+			return execute(g, manager.Command{Mode: mode, Name: name, Options: options})
+		}
+	}
+}
+
+// nameCommand is a manager command on a named window
+func nameCommand(mode string) func(fs *flag.FlagSet, g *globals) func(args []string) error {
+	return func(fs *flag.FlagSet, g *globals) func(args []string) error {
+		return func(args []string) error {
+			name, err := nameArg(args)
+			if err != nil {
+				return err
+			}
+			return execute(g, manager.Command{Mode: mode, Name: name})
+		}
+	}
+}
+
+// cycleCommand is next or prev, which accept -wrap
+func cycleCommand(mode string) func(fs *flag.FlagSet, g *globals) func(args []string) error {
+	return func(fs *flag.FlagSet, g *globals) func(args []string) error {
+		var wrap optionalBool
+		fs.Var(&wrap, "wrap", "Wrap around at the ends, overriding cycle_wrap in the config")
+		return noArgs(func(g *globals) error {
+			cmd := manager.Command{Mode: mode, Options: map[string]string{}}
+			if wrap.set {
+				cmd.Options["wrap"] = strconv.FormatBool(wrap.value)
+			}
+			return execute(g, cmd)
+		})(fs, g)
+	}
+}
+
+// simpleCommand is a manager command without arguments
+func simpleCommand(mode string) func(fs *flag.FlagSet, g *globals) func(args []string) error {
+	return noArgs(func(g *globals) error {
+		return execute(g, manager.Command{Mode: mode})
+	})
+}
+
+// noArgs adapts a function to a command that takes no arguments
+func noArgs(fn func(g *globals) error) func(fs *flag.FlagSet, g *globals) func(args []string) error {
+	return func(fs *flag.FlagSet, g *globals) func(args []string) error {
+		return func(args []string) error {
+			if len(args) > 0 {
+				return usagef("unexpected arguments: %s", strings.Join(args, " "))
+			}
+			return fn(g)
+		}
+	}
+}
+
+func nameArg(args []string) (string, error) {
+	switch len(args) {
+	case 0:
+		return "", usagef("name is required")
+	case 1:
+		return args[0], nil
+	default:
+		return "", usagef("unexpected arguments: %s", strings.Join(args[1:], " "))
+	}
+}
+
+// statusCommand prints the tracked windows as a table or as JSON
+func statusCommand(fs *flag.FlagSet, g *globals) func(args []string) error {
+	asJSON := fs.Bool("json", false, "Print JSON instead of a table")
+	return noArgs(func(g *globals) error {
+		cfg, err := loadConfig(g)
+		if err != nil {
+			return err
+		}
+		m, err := newManager(cfg)
+		if err != nil {
+			return err
+		}
+		status, err := m.Status()
+		if err != nil {
+			return err
+		}
+		if *asJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(status)
+		}
+		return printStatus(os.Stdout, status)
+	})(fs, g)
+}
+
+// printStatus writes status as an aligned table
+func printStatus(w io.Writer, status []manager.WindowStatus) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tID\tSTATE\tLATEST\tALIVE\tFOCUSED\tWORKSPACE\tCLASS\tTITLE")
+	for _, s := range status {
+		latest := "-"
+		if s.Latest > 0 {
+			latest = strconv.Itoa(s.Latest)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			s.Name, s.ID, s.State, latest, yesNo(s.Alive), yesNo(s.Focused), s.Workspace, s.Class, s.Title)
+	}
+	return tw.Flush()
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// barCommand prints a status bar line, and with -follow another one
+// whenever the state changes. Changes are pushed by the daemon when it runs
+// and polled for otherwise.
+func barCommand(fs *flag.FlagSet, g *globals) func(args []string) error {
+	output := fs.String("format", "waybar", "Output format: waybar or polybar")
+	follow := fs.Bool("follow", false, "Keep running and print a new line whenever the state changes")
+	interval := fs.Duration("interval", time.Second, "How often to check the state with -follow while no daemon is running")
+	format := bar.DefaultFormat
+	fs.StringVar(&format.Visible, "visible-format", format.Visible, "Label pattern for visible windows")
+	fs.StringVar(&format.Hidden, "hidden-format", format.Hidden, "Label pattern for hidden windows")
+	fs.StringVar(&format.Command, "command", format.Command, "Command run as '<command> focus <name>' when a window is clicked in polybar")
+	window := fs.String("window", "", "Only print the tracked window `name`, for a waybar module per window")
+	return noArgs(func(g *globals) error {
+		var render func([]bar.Item) (string, error)
+		switch *output {
+		case "waybar":
+			render = func(items []bar.Item) (string, error) {
+				line, err := bar.Waybar(items, format)
+				return string(line), err
+			}
+		case "polybar":
+			render = func(items []bar.Item) (string, error) {
+				return bar.Polybar(items, format), nil
+			}
+		default:
+			return usagef("unknown bar format: %s", *output)
+		}
+
+		cfg, err := loadConfig(g)
+		if err != nil {
+			return err
+		}
+		state, err := manager.NewStateManagement(cfg)
+		if err != nil {
+			return err
+		}
+
+		var last string
+		update := func() error {
+			items := bar.Items(state)
+			if *window != "" {
+				items = bar.Only(items, *window)
+			}
+			line, err := render(items)
+			if err != nil {
+				return err
+			}
+			if line != last {
+				fmt.Println(line)
+				last = line
+			}
+			return nil
+		}
+		if err := update(); err != nil || !*follow {
+			return err
+		}
+
+		for {
+			if !g.noDaemon {
+				err := daemon.Subscribe(socketPath(cfg), func() {
+					if err := update(); err != nil {
+						log.Printf("updating bar: %v", err)
+					}
+				})
+				if err != nil && !errors.Is(err, daemon.ErrUnavailable) {
+					log.Printf("following daemon: %v", err)
+				}
+			}
+			time.Sleep(*interval)
+			if err := update(); err != nil {
+				log.Printf("updating bar: %v", err)
+			}
+		}
+	})(fs, g)
+}
+
+// loadConfig loads the configuration, applying the global flags that
+// override it
+func loadConfig(g *globals) (*config.Config, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("loading config: %v", err)
+	}
+	if g.session != "" {
+		cfg.Session = g.session
+	}
+	return cfg, nil
+}
+
+// execute hands cmd to a running daemon, executing it in process when there
+// is none
+func execute(g *globals, cmd manager.Command) error {
+	cfg, err := loadConfig(g)
+	if err != nil {
+		return err
+	}
+
+	if !g.noDaemon {
+		err := daemon.Send(socketPath(cfg), cmd)
+		if !errors.Is(err, daemon.ErrUnavailable) {
+			return err
+		}
+		log.Printf("daemon not reachable, executing in process: %v", err)
+	}
+
+	m, err := newManager(cfg)
+	if err != nil {
+		return err
+	}
+	return m.Go(cmd)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hellola/startorswitch/manager"
+)
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"focus", "focus"},
+		{"f", "focus"},
+		{"a", "app"},
+		{"application", "app"},
+		{"hl", "toggle-latest"},
+		{"hide-latest", "toggle-latest"},
+		{"r", "reset"},
+	}
+	for _, tt := range tests {
+		cmd := lookup(tt.name)
+		if cmd == nil || cmd.name != tt.want {
+			t.Errorf("lookup(%s) = %v, want %s", tt.name, cmd, tt.want)
+		}
+	}
+	if cmd := lookup("bogus"); cmd != nil {
+		t.Errorf("lookup(bogus) = %s, want nil", cmd.name)
+	}
+}
+
+func TestParseInterspersed(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	switchTo := fs.Bool("switch-to", false, "")
+	padding := fs.Int("top-padding", 0, "")
+
+	args, err := parseInterspersed(fs, []string{"term", "-switch-to", "-top-padding", "30"})
+	if err != nil {
+		t.Fatalf("parseInterspersed() error = %v", err)
+	}
+	if !reflect.DeepEqual(args, []string{"term"}) {
+		t.Errorf("args = %v, want [term]", args)
+	}
+	if !*switchTo || *padding != 30 {
+		t.Errorf("switch-to = %v, top-padding = %d, want true and 30", *switchTo, *padding)
+	}
+}
+
+func TestRun_UsageErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"no command", nil, exitUsage},
+		{"unknown command", []string{"bogus"}, exitUsage},
+		{"missing name", []string{"focus"}, exitUsage},
+		{"extra name", []string{"f", "term", "notes"}, exitUsage},
+		{"unexpected argument", []string{"hide-all", "term"}, exitUsage},
+		{"unknown flag", []string{"app", "-bogus", "term"}, exitUsage},
+		{"bad flag value", []string{"app", "-top-padding", "x", "term"}, exitUsage},
+		{"help", []string{"help"}, exitOK},
+		{"command help", []string{"help", "app"}, exitOK},
+		{"help flag", []string{"focus", "-h"}, exitOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := run(tt.args, io.Discard); got != tt.want {
+				t.Errorf("run(%q) = %d, want %d", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintStatus(t *testing.T) {
+	var out strings.Builder
+	err := printStatus(&out, []manager.WindowStatus{
+		{Name: "notes", ID: "0x02", State: "hidden", Alive: true, Class: "Obsidian", Title: "notes"},
+		{Name: "term", ID: "0x01", State: "visible", Latest: 1, Alive: true, Focused: true, Workspace: "1", Class: "kitty", Title: "htop"},
+	})
+	if err != nil {
+		t.Fatalf("printStatus() error = %v", err)
+	}
+	want := `NAME   ID    STATE    LATEST  ALIVE  FOCUSED  WORKSPACE  CLASS     TITLE
+notes  0x02  hidden   -       yes    no                  Obsidian  notes
+term   0x01  visible  1       yes    yes      1          kitty     htop
+`
+	if out.String() != want {
+		t.Errorf("printStatus() =\n%s\nwant\n%s", out.String(), want)
+	}
+}
@@ -5,12 +5,244 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// State backends supported by the manager
+const (
+	StateBackendRedis = "redis"
+	StateBackendFile  = "file"
 )
 
 // Config represents the application configuration
 type Config struct {
-	WindowManager string `json:"window_manager"`
-	RedisAddr     string `json:"redis_addr"`
+	WindowManager string         `json:"window_manager"`
+	RedisAddr     string         `json:"redis_addr"`
+	StateBackend  string         `json:"state_backend"`
+	StateDir      string         `json:"state_dir"`
+	Apps          map[string]App `json:"apps"`
+	// RedisUsername and RedisPassword authenticate with Redis 6 ACLs, or
+	// just the password with requirepass
+	RedisUsername string `json:"redis_username"`
+	RedisPassword string `json:"redis_password"`
+	// RedisDB selects the Redis database, 0 by default
+	RedisDB int `json:"redis_db"`
+	// RedisSocket is the path of a unix socket used instead of RedisAddr
+	RedisSocket string `json:"redis_socket"`
+	// RedisTLS enables TLS for the Redis connection
+	RedisTLS *RedisTLS `json:"redis_tls"`
+	// RedisKeyPrefix is prepended to every key the Redis backend uses, so
+	// several users can share an instance, e.g. "startorswitch:"
+	RedisKeyPrefix string `json:"redis_key_prefix"`
+	// MatchPrecedence is the default order match criteria are applied in,
+	// see App.MatchPrecedence
+	MatchPrecedence []string `json:"match_precedence"`
+	// Exclusive is the default for App.Exclusive
+	Exclusive bool `json:"exclusive"`
+	// Groups maps group names to the tracked names that belong to them
+	Groups map[string][]string `json:"groups"`
+	// CycleWrap makes next and prev wrap around at the ends of the
+	// order, see CycleWraps
+	CycleWrap *bool `json:"cycle_wrap"`
+	// RestoreFocus is the default for App.RestoreFocus
+	RestoreFocus *bool `json:"restore_focus"`
+	// Follow is the default for App.Follow
+	Follow bool `json:"follow"`
+	// Session namespaces the state and the daemon socket, so several
+	// graphical sessions on one machine or sharing a Redis instance leave
+	// each other's windows alone. Detected when empty, see DetectSession.
+	Session string `json:"session"`
+	// SocketPath is where the daemon listens, defaulting to
+	// $XDG_RUNTIME_DIR/startorswitch-<session>.sock
+	SocketPath string `json:"socket_path"`
+	// Picker is the dmenu compatible command used by pick, e.g.
+	// ["rofi", "-dmenu", "-i"]. The first of rofi, fuzzel, wofi and dmenu
+	// found is used when empty.
+	Picker []string `json:"picker"`
+}
+
+// RedisTLS holds the TLS settings of the Redis connection. The system roots
+// verify the server unless CAFile is given, CertFile and KeyFile add a client
+// certificate.
+type RedisTLS struct {
+	CAFile             string `json:"ca_file"`
+	CertFile           string `json:"cert_file"`
+	KeyFile            string `json:"key_file"`
+	ServerName         string `json:"server_name"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+}
+
+// App describes how to launch an application and recognise its window
+type App struct {
+	Name    string            `json:"-"`
+	Command string            `json:"command"`
+	Args    []string          `json:"args"`
+	Dir     string            `json:"dir"`
+	Env     map[string]string `json:"env"`
+	Match   Match             `json:"match"`
+	// MatchPrecedence orders the criteria "pid", "class", "instance",
+	// "role" and "title" when picking a window. Criteria left out are not
+	// used.
+	MatchPrecedence []string `json:"match_precedence"`
+	// Exclusive hides every other visible tracked window when this one is
+	// shown. Unset means the global setting applies.
+	Exclusive *bool `json:"exclusive"`
+	// Groups lists the groups the app belongs to, in addition to those
+	// naming it in Config.Groups
+	Groups []string `json:"groups"`
+	// RestoreFocus returns focus to the previously focused window when
+	// the app is hidden. Unset means the global setting applies, which
+	// defaults to on.
+	RestoreFocus *bool `json:"restore_focus"`
+	// Geometry sizes and places the window on the focused monitor every
+	// time it is shown. Unset leaves the window where it was.
+	Geometry *Geometry `json:"geometry"`
+	// Follow switches to the desktop the window lives on when it is shown,
+	// instead of summoning it to the focused one. Unset means the global
+	// setting applies.
+	Follow *bool `json:"follow"`
+}
+
+// Geometry describes where a window goes on the focused monitor. Width and
+// Height are pixels ("800") or a percentage of the monitor ("40%") and
+// default to half of it. Anchor is center (the default), top, bottom,
+// left, right, top-left, top-right, bottom-left or bottom-right, and the
+// offsets move the window away from its anchored position.
+type Geometry struct {
+	Width   string `json:"width"`
+	Height  string `json:"height"`
+	Anchor  string `json:"anchor"`
+	OffsetX int    `json:"offset_x"`
+	OffsetY int    `json:"offset_y"`
+}
+
+// IsExclusive reports whether showing the app hides the other windows
+func (a App) IsExclusive() bool {
+	return a.Exclusive != nil && *a.Exclusive
+}
+
+// Follows reports whether showing the app switches to its desktop rather
+// than bringing the window to the focused one
+func (a App) Follows() bool {
+	return a.Follow != nil && *a.Follow
+}
+
+// RestoresFocus reports whether hiding the app focuses the window that had
+// focus before it was shown
+func (a App) RestoresFocus() bool {
+	return a.RestoreFocus == nil || *a.RestoreFocus
+}
+
+// Match holds the rules a window must satisfy to belong to an App. Every
+// non-empty rule has to match. Title is a regular expression, the other
+// rules are compared case-insensitively.
+type Match struct {
+	Class    string `json:"class"`
+	Instance string `json:"instance"`
+	Title    string `json:"title"`
+	Role     string `json:"role"`
+}
+
+// IsZero reports whether no match rules are configured
+func (m Match) IsZero() bool {
+	return m == Match{}
+}
+
+// DefaultApp returns the App used for names without an apps entry: name is
+// both the command to run and what the window is matched against
+func DefaultApp(name string) App {
+	return App{Name: name, Command: name}
+}
+
+// App resolves name through the apps map, falling back to DefaultApp
+func (c *Config) App(name string) App {
+	app, ok := c.Apps[name]
+	if !ok {
+		app = DefaultApp(name)
+	}
+	app.Name = name
+	if app.Command == "" {
+		app.Command = name
+	}
+	if len(app.MatchPrecedence) == 0 {
+		app.MatchPrecedence = c.MatchPrecedence
+	}
+	if app.Exclusive == nil {
+		exclusive := c.Exclusive
+		app.Exclusive = &exclusive
+	}
+	if app.RestoreFocus == nil {
+		app.RestoreFocus = c.RestoreFocus
+	}
+	if app.Follow == nil {
+		follow := c.Follow
+		app.Follow = &follow
+	}
+	return app
+}
+
+// GroupsOf returns the configured groups name belongs to, sorted
+func (c *Config) GroupsOf(name string) []string {
+	seen := make(map[string]bool)
+	for _, group := range c.Apps[name].Groups {
+		seen[group] = true
+	}
+	for group, members := range c.Groups {
+		for _, member := range members {
+			if member == name {
+				seen[group] = true
+			}
+		}
+	}
+	groups := make([]string, 0, len(seen))
+	for group := range seen {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// CycleWraps reports whether cycling wraps around, which it does unless
+// turned off
+func (c *Config) CycleWraps() bool {
+	return c.CycleWrap == nil || *c.CycleWrap
+}
+
+// sessionVariables are the environment variables identifying a graphical
+// session, in the order DetectSession tries them. The i3 and sway sockets
+// are left out, their paths contain the window manager's PID and would
+// start a new session on every restart.
+var sessionVariables = []string{"WAYLAND_DISPLAY", "DISPLAY", "BSPWM_SOCKET"}
+
+// DetectSession identifies the graphical session from the first of
+// WAYLAND_DISPLAY, DISPLAY and BSPWM_SOCKET that is set, qualified with the
+// host name since display names repeat across machines sharing a Redis
+// instance. It returns "" outside of a session.
+func DetectSession() string {
+	for _, name := range sessionVariables {
+		if value := os.Getenv(name); value != "" {
+			host, _ := os.Hostname()
+			return host + "/" + value
+		}
+	}
+	return ""
+}
+
+// SessionKey returns the configured or detected session in a form usable in
+// file names and Redis keys, or "" when there is none
+func (c *Config) SessionKey() string {
+	session := c.Session
+	if session == "" {
+		session = DetectSession()
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		}
+		return '_'
+	}, session)
 }
 
 // DefaultConfig returns the default configuration
@@ -18,7 +250,22 @@ func DefaultConfig() *Config {
 	return &Config{
 		WindowManager: "bspwm",
 		RedisAddr:     "localhost:6379",
+		StateBackend:  StateBackendFile,
+		StateDir:      DefaultStateDir(),
+	}
+}
+
+// DefaultStateDir returns the directory used by the file state backend,
+// following the XDG base directory specification
+func DefaultStateDir() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "startorswitch")
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "startorswitch")
 	}
+	return filepath.Join(homeDir, ".local", "state", "startorswitch")
 }
 
 // LoadConfig loads configuration from a file
@@ -44,8 +291,32 @@ func LoadConfig() (*Config, error) {
 		log.Printf("error unmarshalling config:  %s", err.Error())
 		return DefaultConfig(), nil
 	}
+	config.applyDefaults()
 
-	log.Printf("using config - redis: %s, wm:  %s", config.RedisAddr, config.WindowManager)
+	log.Printf("using config - state: %s, redis: %s, wm:  %s", config.StateBackend, config.RedisAddr, config.WindowManager)
 
 	return &config, nil
 }
+
+// applyDefaults fills in fields missing from a loaded config file. Configs
+// written before the file backend existed that name a redis_addr keep using
+// Redis.
+func (c *Config) applyDefaults() {
+	defaults := DefaultConfig()
+	if c.StateBackend == "" {
+		if c.RedisAddr != "" {
+			c.StateBackend = StateBackendRedis
+		} else {
+			c.StateBackend = defaults.StateBackend
+		}
+	}
+	if c.RedisAddr == "" {
+		c.RedisAddr = defaults.RedisAddr
+	}
+	if c.StateDir == "" {
+		c.StateDir = defaults.StateDir
+	}
+	if c.WindowManager == "" {
+		c.WindowManager = defaults.WindowManager
+	}
+}
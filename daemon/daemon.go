@@ -0,0 +1,280 @@
+// Package daemon keeps a Manager alive between invocations and accepts
+// manager.Command requests over a unix socket, so hotkeys don't pay for
+// loading config and connecting to the state backend and window manager on
+// every press.
+package daemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hellola/startorswitch/manager"
+	"github.com/hellola/startorswitch/wm"
+)
+
+// ErrUnavailable is returned by Send when no daemon is listening
+var ErrUnavailable = errors.New("daemon not available")
+
+// request is a single command sent by a client, one JSON object per line.
+// A subscribe request turns the connection into a stream of change events.
+type request struct {
+	Command   manager.Command `json:"command"`
+	Subscribe bool            `json:"subscribe,omitempty"`
+}
+
+// response reports the outcome of a request, or a change to subscribers
+type response struct {
+	Error   string `json:"error,omitempty"`
+	Changed bool   `json:"changed,omitempty"`
+}
+
+// SocketPath returns the default socket location of the daemon serving
+// session, in $XDG_RUNTIME_DIR when available
+func SocketPath(session string) string {
+	name := "startorswitch"
+	if session != "" {
+		name += "-" + session
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, name+".sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d.sock", name, os.Getuid()))
+}
+
+// Server executes commands received over a unix socket against a Manager.
+// Commands are run one at a time, subscribers are told after each of them
+// that the state may have changed.
+type Server struct {
+	mu       sync.Mutex
+	manager  *manager.Manager
+	listener net.Listener
+
+	subMu       sync.Mutex
+	subscribers map[chan struct{}]bool
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+// NewServer creates a new Server for m
+func NewServer(m *manager.Manager) *Server {
+	return &Server{
+		manager:     m,
+		subscribers: make(map[chan struct{}]bool),
+		done:        make(chan struct{}),
+	}
+}
+
+// Listen binds the socket at path. A socket left behind by a daemon that
+// died is replaced, a live one is an error. The socket is only accessible
+// to the current user from the moment it is created, which matters for the
+// fallback in the shared temporary directory.
+func (s *Server) Listen(path string) error {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("daemon already listening on %s", path)
+	}
+	os.Remove(path)
+
+	umask := syscall.Umask(0o177)
+	listener, err := net.Listen("unix", path)
+	syscall.Umask(umask)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		listener.Close()
+		return err
+	}
+	s.listener = listener
+	return nil
+}
+
+// Serve accepts connections until Close is called
+func (s *Server) Serve() error {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+// Close stops the server and removes its socket. Closing it again does
+// nothing.
+func (s *Server) Close() error {
+	if s.listener == nil {
+		return nil
+	}
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+		// Closing a unix listener created by Listen unlinks the socket
+		err = s.listener.Close()
+	})
+	return err
+}
+
+// Execute runs cmd against the manager, serialised with all other commands
+func (s *Server) Execute(cmd manager.Command) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.notify()
+	return s.manager.Go(cmd)
+}
+
+// Reconcile applies a window manager event to the state, serialised with
+// all commands
+func (s *Server) Reconcile(event wm.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.notify()
+	return s.manager.Reconcile(event)
+}
+
+// notify tells every subscriber that the state may have changed. Slow
+// subscribers get one pending notification rather than a backlog.
+func (s *Server) notify() {
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	for ch := range s.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// subscribe streams change events to conn until the client goes away or
+// the server is closed. The first event is sent right away so clients can
+// render the current state.
+func (s *Server) subscribe(conn net.Conn, encoder *json.Encoder) {
+	ch := make(chan struct{}, 1)
+	ch <- struct{}{}
+	s.subMu.Lock()
+	s.subscribers[ch] = true
+	s.subMu.Unlock()
+	defer func() {
+		s.subMu.Lock()
+		delete(s.subscribers, ch)
+		s.subMu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-ch:
+			if err := encoder.Encode(response{Changed: true}); err != nil {
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Watch reconciles the state from the window manager's event stream until
+// it ends. Backends that cannot report events are left alone.
+func (s *Server) Watch() error {
+	source, ok := s.manager.WM.(wm.EventSource)
+	if !ok {
+		log.Printf("daemon: window manager does not report events")
+		return nil
+	}
+	return source.Watch(func(event wm.Event) {
+		if err := s.Reconcile(event); err != nil {
+			log.Printf("daemon: reconciling %+v: %v", event, err)
+		}
+	})
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	encoder := json.NewEncoder(conn)
+	for scanner.Scan() {
+		var req request
+		var resp response
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp.Error = fmt.Sprintf("invalid request: %v", err)
+		} else if req.Subscribe {
+			s.subscribe(conn, encoder)
+			return
+		} else {
+			log.Printf("daemon: executing %+v", req.Command)
+			if err := s.Execute(req.Command); err != nil {
+				resp.Error = err.Error()
+			}
+		}
+		if err := encoder.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+// Send asks the daemon listening on path to execute cmd. It returns
+// ErrUnavailable if the daemon cannot be reached, in which case the caller
+// should run the command itself.
+func Send(path string, cmd manager.Command) error {
+	conn, err := net.DialTimeout("unix", path, 100*time.Millisecond)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(request{Command: cmd}); err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	var resp response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return fmt.Errorf("reading daemon response: %v", err)
+	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+	return nil
+}
+
+// Subscribe calls changed whenever the state held by the daemon listening on
+// path may have changed, starting with once right away. It returns
+// ErrUnavailable if the daemon cannot be reached and nil when the daemon
+// goes away.
+func Subscribe(path string, changed func()) error {
+	conn, err := net.DialTimeout("unix", path, 100*time.Millisecond)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(request{Subscribe: true}); err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	decoder := json.NewDecoder(conn)
+	for {
+		var resp response
+		if err := decoder.Decode(&resp); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("reading daemon events: %v", err)
+		}
+		if resp.Error != "" {
+			return errors.New(resp.Error)
+		}
+		if resp.Changed {
+			changed()
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package daemon
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hellola/startorswitch/config"
+	"github.com/hellola/startorswitch/manager"
+	"github.com/hellola/startorswitch/wm/wmtest"
+)
+
+// startServer runs a Server backed by in-memory state and a fake WM. The
+// socket lives in a short temporary directory since unix socket paths are
+// limited to around 100 bytes.
+func startServer(t *testing.T) (string, *manager.MemoryStateManagement, *wmtest.Fake) {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "sos")
+	if err != nil {
+		t.Fatalf("MkdirTemp failed: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	state := manager.NewMemoryStateManagement()
+	fake := wmtest.NewFake()
+	server := NewServer(&manager.Manager{
+		StateMgr: state,
+		WM:       fake,
+		Config:   config.DefaultConfig(),
+	})
+	path := filepath.Join(dir, "daemon.sock")
+	if err := server.Listen(path); err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	done := make(chan error)
+	go func() { done <- server.Serve() }()
+	t.Cleanup(func() {
+		server.Close()
+		if err := <-done; err != nil {
+			t.Errorf("Serve() error = %v", err)
+		}
+	})
+	return path, state, fake
+}
+
+func TestSend(t *testing.T) {
+	path, state, fake := startServer(t)
+	fake.SetFocused("0x01")
+
+	if err := Send(path, manager.Command{Mode: "f", Name: "term"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if id := state.GetID("term"); id != "0x01" {
+		t.Errorf("GetID() = %s, want 0x01", id)
+	}
+	if !fake.IsHidden("0x01") {
+		t.Errorf("window 0x01 not hidden")
+	}
+
+	if err := Send(path, manager.Command{Mode: "f", Name: "term"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if fake.IsHidden("0x01") {
+		t.Errorf("window 0x01 still hidden after second toggle")
+	}
+}
+
+func TestSend_ReportsCommandErrors(t *testing.T) {
+	path, _, _ := startServer(t)
+
+	err := Send(path, manager.Command{Mode: "bogus", Name: "term"})
+	if err == nil {
+		t.Fatalf("Send() error = nil, want unknown command")
+	}
+	if errors.Is(err, ErrUnavailable) {
+		t.Errorf("Send() error = %v, want a command error", err)
+	}
+}
+
+func TestSend_Unavailable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.sock")
+	if err := Send(path, manager.Command{Mode: "s"}); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Send() error = %v, want ErrUnavailable", err)
+	}
+}
+
+func TestServer_ListenRefusesLiveSocket(t *testing.T) {
+	path, _, _ := startServer(t)
+
+	second := NewServer(nil)
+	if err := second.Listen(path); err == nil {
+		second.Close()
+		t.Errorf("Listen() on a live socket succeeded")
+	}
+}
+
+func TestServer_ListenPrivateSocket(t *testing.T) {
+	path, _, _ := startServer(t)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("socket permissions = %o, want 600", perm)
+	}
+}
+
+func TestServer_CloseTwice(t *testing.T) {
+	path, _, _ := startServer(t)
+
+	second := NewServer(nil)
+	if err := second.Listen(path + ".2"); err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	if err := second.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if err := second.Close(); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	path, _, fake := startServer(t)
+	fake.SetFocused("0x01")
+
+	changes := make(chan struct{}, 10)
+	go Subscribe(path, func() { changes <- struct{}{} })
+	waitForChange(t, changes)
+
+	if err := Send(path, manager.Command{Mode: "f", Name: "term"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	waitForChange(t, changes)
+}
+
+func waitForChange(t *testing.T, changes <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-changes:
+	case <-time.After(time.Second):
+		t.Fatalf("no change notification")
+	}
+}
+
+func TestSubscribe_Unavailable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.sock")
+	if err := Subscribe(path, func() {}); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Subscribe() error = %v, want ErrUnavailable", err)
+	}
+}
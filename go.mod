@@ -2,7 +2,10 @@ module github.com/hellola/startorswitch
 
 go 1.24.1
 
-require github.com/redis/go-redis/v9 v9.7.3
+require (
+	github.com/jezek/xgb v1.1.1
+	github.com/redis/go-redis/v9 v9.7.3
+)
 
 require (
 	github.com/cespare/xxhash/v2 v2.2.0 // indirect
@@ -1,13 +1,14 @@
 package main
 
 import (
-	"flag"
 	"fmt"
 	"log"
 	"os"
-	"strings"
+	"os/signal"
+	"syscall"
 
 	"github.com/hellola/startorswitch/config"
+	"github.com/hellola/startorswitch/daemon"
 	"github.com/hellola/startorswitch/manager"
 	"github.com/hellola/startorswitch/wm"
 )
@@ -20,103 +21,80 @@ func (w *DiscardWriter) Write(p []byte) (n int, err error) {
 }
 
 func main() {
-	// Define flags
-	mode := flag.String("mode", "", "Mode of operation (f/focus, a/application, c/clean, h/hide, hl/hide-latest, ha/hide-all, s/show-all, r/reset)")
-	name := flag.String("name", "", "Name of the window/application")
-	options := flag.String("options", "", "Additional options (comma-separated)")
-	verbose := flag.Bool("verbose", false, "Enable verbose logging")
-	flag.Parse()
-
-	// Set up logging based on verbose flag
-	if !*verbose {
-		log.SetOutput(&DiscardWriter{})
-	} else {
-		log.SetOutput(os.Stderr)
-	}
-
-	// Handle reset mode
-	if *mode == "r" {
-		cfg, err := config.LoadConfig()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
-			os.Exit(1)
-		}
-
-		wmFactory := wm.NewFactory()
-		wmIntegration, err := wmFactory.CreateWM(cfg)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error creating window manager: %v\n", err)
-			os.Exit(1)
-		}
-
-		m, err := manager.NewManager(cfg, wmIntegration)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
-
-		if err := m.StateMgr.ResetAll(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
-		return
-	}
+	os.Exit(run(os.Args[1:], os.Stderr))
+}
 
-	// Validate required flags
-	if *mode == "" {
-		fmt.Fprintf(os.Stderr, "Error: mode is required\n")
-		flag.Usage()
-		os.Exit(1)
+// newManager creates the window manager integration and state backend
+// selected in cfg
+func newManager(cfg *config.Config) (*manager.Manager, error) {
+	wmFactory := wm.NewFactory()
+	wmIntegration, err := wmFactory.CreateWM(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("creating window manager: %v", err)
 	}
+	return manager.NewManager(cfg, wmIntegration)
+}
 
-	if *name == "" && *mode != "ha" && *mode != "s" {
-		fmt.Fprintf(os.Stderr, "Error: name is required for this mode\n")
-		flag.Usage()
-		os.Exit(1)
+// socketPath returns the daemon socket configured in cfg or the default one
+// of the session
+func socketPath(cfg *config.Config) string {
+	if cfg.SocketPath != "" {
+		return cfg.SocketPath
 	}
+	return daemon.SocketPath(cfg.SessionKey())
+}
 
-	// Load config and create manager
-	cfg, err := config.LoadConfig()
+// runDaemon serves commands on the daemon socket until interrupted
+func runDaemon(g *globals) error {
+	cfg, err := loadConfig(g)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
-		os.Exit(1)
+		return err
 	}
-
-	wmFactory := wm.NewFactory()
-	wmIntegration, err := wmFactory.CreateWM(cfg)
+	m, err := newManager(cfg)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating window manager: %v\n", err)
-		os.Exit(1)
+		return err
 	}
 
-	m, err := manager.NewManager(cfg, wmIntegration)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	server := daemon.NewServer(m)
+	path := socketPath(cfg)
+	if err := server.Listen(path); err != nil {
+		return err
 	}
+	log.Printf("daemon listening on %s", path)
 
-	// Parse options into map
-	optionsMap := make(map[string]string)
-	if *options != "" {
-		for _, opt := range strings.Split(*options, ",") {
-			parts := strings.Split(opt, "=")
-			if len(parts) == 2 {
-				optionsMap[parts[0]] = parts[1]
-			} else {
-				optionsMap[opt] = "true"
-			}
+	go func() {
+		if err := server.Watch(); err != nil {
+			log.Printf("daemon: watching window manager events: %v", err)
 		}
-	}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		server.Close()
+	}()
+	return server.Serve()
+}
 
-	// Create command and execute
-	cmd := manager.Command{
-		Mode:    *mode,
-		Name:    *name,
-		Options: optionsMap,
+// runWatch keeps the state in sync with the window manager's event stream,
+// for setups that don't run the daemon
+func runWatch(g *globals) error {
+	cfg, err := loadConfig(g)
+	if err != nil {
+		return err
 	}
-
-	if err := m.Go(cmd); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	m, err := newManager(cfg)
+	if err != nil {
+		return err
+	}
+	source, ok := m.WM.(wm.EventSource)
+	if !ok {
+		return fmt.Errorf("%s does not report window events", cfg.WindowManager)
 	}
+	return source.Watch(func(event wm.Event) {
+		if err := m.Reconcile(event); err != nil {
+			log.Printf("reconciling %+v: %v", event, err)
+		}
+	})
 }
@@ -0,0 +1,99 @@
+package manager
+
+import (
+	"log"
+	"sort"
+)
+
+// CycleOrder returns the tracked names in the order next walks through
+// them: most recently shown first, followed by the windows that are not in
+// the latest set, hidden ones included, by name
+func (m *Manager) CycleOrder() []string {
+	tracked := m.StateMgr.AllTracked()
+	seen := make(map[string]bool)
+	var order []string
+	for _, name := range m.StateMgr.AllLatest() {
+		if _, ok := tracked[name]; ok {
+			order = append(order, name)
+			seen[name] = true
+		}
+	}
+	var rest []string
+	for name := range tracked {
+		if !seen[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	return append(order, rest...)
+}
+
+// Cycle hides the current tracked window and shows the one step positions
+// after it in CycleOrder. The current window is the focused tracked window,
+// or else the first visible one; without one the first (or for a negative
+// step the last) window is shown. At the ends of the order Cycle wraps
+// around if wrap is set and does nothing otherwise.
+//
+// The latest set is left alone so repeated cycling walks a stable order
+// instead of bouncing between the two most recent windows.
+func (m *Manager) Cycle(step int, wrap bool) error {
+	order := m.CycleOrder()
+	if len(order) == 0 {
+		return nil
+	}
+
+	records := make(map[string]WindowRecord)
+	for _, record := range m.StateMgr.Windows() {
+		records[record.Name] = record
+	}
+	focused := m.WM.GetFocusedID()
+	current := -1
+	for i, name := range order {
+		record := records[name]
+		if record.State != Visible {
+			continue
+		}
+		if current < 0 || record.ID == focused {
+			current = i
+		}
+	}
+
+	var target int
+	if current < 0 {
+		if step < 0 {
+			target = len(order) - 1
+		}
+		if err := m.newTracked(order[target], TypeFocused, false).RememberFocus(focused); err != nil {
+			return err
+		}
+	} else {
+		target = current + step
+		if target < 0 || target >= len(order) {
+			if !wrap {
+				log.Printf("Cycle reached the end of %v", order)
+				return nil
+			}
+			target = ((target % len(order)) + len(order)) % len(order)
+		}
+		if target == current {
+			return nil
+		}
+		hidden := m.newTracked(order[current], TypeFocused, false)
+		if err := hidden.Hide(); err != nil {
+			return err
+		}
+		if err := hidden.SetState(NotVisible); err != nil {
+			return err
+		}
+		if err := moveFocusEntry(m.StateMgr, hidden.Name, order[target]); err != nil {
+			return err
+		}
+	}
+
+	shown := m.newTracked(order[target], TypeFocused, false)
+	log.Printf("Cycling to %s", shown.Name)
+	if err := shown.Show(); err != nil {
+		return err
+	}
+	return shown.SetState(Visible)
+}
@@ -0,0 +1,271 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// fileStateData is the on-disk layout of the file state backend. It mirrors
+// the keys used by the Redis backend.
+type fileStateData struct {
+	Version int                     `json:"version"`
+	Windows map[string]WindowRecord `json:"windows"`
+	Prev    string                  `json:"prev,omitempty"`
+	// FocusStack is stored as a key of its own by the Redis backend
+	FocusStack []FocusEntry `json:"focus_stack,omitempty"`
+
+	// Tracked, State, Latest and Groups are only read to migrate a schema
+	// version 1 file
+	Tracked map[string]string   `json:"tracked,omitempty"`
+	State   map[string]string   `json:"state,omitempty"`
+	Latest  map[string]float64  `json:"latest,omitempty"`
+	Groups  map[string][]string `json:"groups,omitempty"`
+}
+
+// FileStateManagement implements StateManagement using a JSON file
+type FileStateManagement struct {
+	windowRecords
+	path     string
+	lockPath string
+	// opLockPath is flocked by Lock for a whole operation, lockPath by
+	// every method call
+	opLockPath string
+}
+
+// NewFileStateManagement creates a new file state management instance
+// storing its data in dir
+func NewFileStateManagement(dir string) (*FileStateManagement, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, "state.json")
+	s := &FileStateManagement{
+		path:       path,
+		lockPath:   path + ".lock",
+		opLockPath: filepath.Join(dir, "operation.lock"),
+	}
+	s.windowRecords = windowRecords{s}
+	return s, nil
+}
+
+// adoptLegacyState moves the state file written to base before state was
+// kept per session into the session directory dir, unless the session
+// already has state of its own. Only the first session to start takes it
+// over, the rename fails for the others.
+func adoptLegacyState(base, dir string) error {
+	legacy := filepath.Join(base, "state.json")
+	path := filepath.Join(dir, "state.json")
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if _, err := os.Stat(legacy); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	log.Printf("Moving state file %s to %s", legacy, path)
+	if err := os.Rename(legacy, path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Lock takes an exclusive flock, which the kernel releases should the
+// process die while holding it
+func (s *FileStateManagement) Lock() (func(), error) {
+	lock, err := os.OpenFile(s.opLockPath, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		lock.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+		lock.Close()
+	}, nil
+}
+
+// errUnchanged is returned by a withLock function to skip writing the file
+var errUnchanged = errors.New("unchanged")
+
+// withLock loads the state file under an exclusive lock, passes it to fn and
+// writes it back if write is set
+func (s *FileStateManagement) withLock(write bool, fn func(data *fileStateData) error) error {
+	lock, err := os.OpenFile(s.lockPath, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	how := syscall.LOCK_SH
+	if write {
+		how = syscall.LOCK_EX
+	}
+	if err := syscall.Flock(int(lock.Fd()), how); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+
+	data, err := s.load()
+	if err != nil {
+		return err
+	}
+	if err := fn(data); err != nil {
+		if errors.Is(err, errUnchanged) {
+			return nil
+		}
+		return err
+	}
+	if !write {
+		return nil
+	}
+	return s.save(data)
+}
+
+func (s *FileStateManagement) load() (*fileStateData, error) {
+	data := &fileStateData{}
+	raw, err := os.ReadFile(s.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, data); err != nil {
+			log.Printf("error unmarshalling state file %s: %v", s.path, err)
+			data = &fileStateData{}
+		}
+	}
+	// Files of schema version 1 are converted when read and written in the
+	// new layout by the next change
+	if len(raw) > 0 && data.Version < stateSchemaVersion {
+		log.Printf("Migrating state file %s to schema version %d", s.path, stateSchemaVersion)
+		data.Windows, data.Prev = migrateRecords(data.Tracked, data.State, data.Latest, data.Groups, time.Nanosecond)
+		data.Tracked, data.State, data.Latest, data.Groups = nil, nil, nil, nil
+	}
+	data.Version = stateSchemaVersion
+	if data.Windows == nil {
+		data.Windows = make(map[string]WindowRecord)
+	}
+	return data, nil
+}
+
+// save atomically replaces the state file by writing to a temporary file in
+// the same directory and renaming it over the original
+func (s *FileStateManagement) save(data *fileStateData) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".state-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func (s *FileStateManagement) Window(name string) (WindowRecord, bool) {
+	var record WindowRecord
+	var ok bool
+	s.withLock(false, func(data *fileStateData) error {
+		record, ok = data.Windows[name]
+		return nil
+	})
+	return record, ok
+}
+
+func (s *FileStateManagement) Windows() []WindowRecord {
+	var records []WindowRecord
+	s.withLock(false, func(data *fileStateData) error {
+		for _, record := range data.Windows {
+			records = append(records, record)
+		}
+		return nil
+	})
+	return sortRecords(records)
+}
+
+// UpdateWindow only writes the file back if update changed the record
+func (s *FileStateManagement) UpdateWindow(name string, update func(record *WindowRecord) bool) error {
+	return s.withLock(true, func(data *fileStateData) error {
+		record, ok := data.Windows[name]
+		if !ok {
+			record = WindowRecord{Name: name}
+		}
+		if !update(&record) {
+			return errUnchanged
+		}
+		data.Windows[name] = record
+		return nil
+	})
+}
+
+func (s *FileStateManagement) DestroyID(name string) error {
+	return s.withLock(true, func(data *fileStateData) error {
+		delete(data.Windows, name)
+		return nil
+	})
+}
+
+func (s *FileStateManagement) StorePrevID(id string) error {
+	return s.withLock(true, func(data *fileStateData) error {
+		data.Prev = id
+		return nil
+	})
+}
+
+func (s *FileStateManagement) LoadPrevID() string {
+	var id string
+	s.withLock(false, func(data *fileStateData) error {
+		id = data.Prev
+		return nil
+	})
+	return id
+}
+
+func (s *FileStateManagement) FocusStack() []FocusEntry {
+	var stack []FocusEntry
+	s.withLock(false, func(data *fileStateData) error {
+		stack = append(stack, data.FocusStack...)
+		return nil
+	})
+	return stack
+}
+
+func (s *FileStateManagement) SetFocusStack(stack []FocusEntry) error {
+	return s.withLock(true, func(data *fileStateData) error {
+		data.FocusStack = append([]FocusEntry(nil), stack...)
+		return nil
+	})
+}
+
+func (s *FileStateManagement) ResetAll() error {
+	return s.withLock(true, func(data *fileStateData) error {
+		data.Windows = make(map[string]WindowRecord)
+		data.Prev = ""
+		data.FocusStack = nil
+		return nil
+	})
+}
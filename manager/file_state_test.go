@@ -0,0 +1,243 @@
+package manager
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hellola/startorswitch/config"
+)
+
+func TestFileStateManagement_GetID(t *testing.T) {
+	state, err := NewFileStateManagement(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create file state management: %v", err)
+	}
+
+	name := "testing-1"
+	expectedId := "12345"
+
+	if err := state.StoreID(name, expectedId); err != nil {
+		t.Errorf("StoreID failed: %v", err)
+	}
+	if id := state.GetID(name); id != expectedId {
+		t.Errorf("GetID failed: want %s got %s", expectedId, id)
+	}
+
+	if err := state.DestroyID(name); err != nil {
+		t.Errorf("DestroyID failed: %v", err)
+	}
+	if state.IsTracked(name) {
+		t.Errorf("IsTracked() = true after DestroyID")
+	}
+}
+
+func TestFileStateManagement_Persistence(t *testing.T) {
+	dir := t.TempDir()
+	first, err := NewFileStateManagement(dir)
+	if err != nil {
+		t.Fatalf("Failed to create file state management: %v", err)
+	}
+	if err := first.StoreID("term", "0x01"); err != nil {
+		t.Fatalf("StoreID failed: %v", err)
+	}
+	if err := first.SetState("term", NotVisible); err != nil {
+		t.Fatalf("SetState failed: %v", err)
+	}
+	if _, err := first.LatestShown("term"); err != nil {
+		t.Fatalf("LatestShown failed: %v", err)
+	}
+	if _, err := first.LatestShown("notes"); err != nil {
+		t.Fatalf("LatestShown failed: %v", err)
+	}
+
+	second, err := NewFileStateManagement(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen file state management: %v", err)
+	}
+	if got := second.GetState("0x01"); got != NotVisible {
+		t.Errorf("GetState() = %v, want %v", got, NotVisible)
+	}
+	if got := second.LatestCount(); got != 2 {
+		t.Errorf("LatestCount() = %d, want 2", got)
+	}
+	latest, err := second.LatestShown("")
+	if err != nil {
+		t.Fatalf("LatestShown failed: %v", err)
+	}
+	if latest != "notes" {
+		t.Errorf("LatestShown() = %s, want notes", latest)
+	}
+	hidden := second.AllHidden()
+	if len(hidden) != 1 || hidden[0].Name != "term" {
+		t.Errorf("AllHidden() = %v, want [term]", hidden)
+	}
+
+	if err := second.ResetAll(); err != nil {
+		t.Fatalf("ResetAll failed: %v", err)
+	}
+	if len(first.AllTracked()) != 0 {
+		t.Errorf("AllTracked() not empty after ResetAll")
+	}
+}
+
+func TestFileStateManagement_Groups(t *testing.T) {
+	state, err := NewFileStateManagement(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create file state management: %v", err)
+	}
+	state.StoreID("mail", "0x02")
+	if err := state.AddToGroups("mail", "work", "comms"); err != nil {
+		t.Fatalf("AddToGroups failed: %v", err)
+	}
+	if err := state.AddToGroups("mail", "comms"); err != nil {
+		t.Fatalf("AddToGroups failed: %v", err)
+	}
+	if got := state.Groups("mail"); len(got) != 2 || got[0] != "comms" || got[1] != "work" {
+		t.Errorf("Groups() = %v, want [comms work]", got)
+	}
+
+	if err := state.DestroyID("mail"); err != nil {
+		t.Fatalf("DestroyID failed: %v", err)
+	}
+	if got := state.Groups("mail"); len(got) != 0 {
+		t.Errorf("Groups() = %v after DestroyID, want none", got)
+	}
+}
+
+func TestFileStateManagement_Migration(t *testing.T) {
+	dir := t.TempDir()
+	old := `{
+		"tracked": {"term": "0x01", "notes": "0x02", "prev": "0x09"},
+		"state": {"0x01": "2", "0x02": "1"},
+		"latest": {"term": 1700000000000000000, "notes": 1700000001000000000},
+		"groups": {"notes": ["work"]},
+		"focus_stack": [{"name": "notes", "id": "0x09"}]
+	}`
+	if err := os.WriteFile(filepath.Join(dir, "state.json"), []byte(old), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	state, err := NewFileStateManagement(dir)
+	if err != nil {
+		t.Fatalf("Failed to create file state management: %v", err)
+	}
+
+	want := []WindowRecord{
+		{Name: "notes", ID: "0x02", State: Visible, Groups: []string{"work"}, LatestAt: time.Unix(0, 1700000001000000000)},
+		{Name: "term", ID: "0x01", State: NotVisible, LatestAt: time.Unix(0, 1700000000000000000)},
+	}
+	if got := state.Windows(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Windows() = %+v, want %+v", got, want)
+	}
+	if prev := state.LoadPrevID(); prev != "0x09" {
+		t.Errorf("LoadPrevID() = %s, want 0x09", prev)
+	}
+	if tracked := state.AllTracked(); len(tracked) != 2 {
+		t.Errorf("AllTracked() = %v, want term and notes only", tracked)
+	}
+	if got := state.AllLatest(); !reflect.DeepEqual(got, []string{"notes", "term"}) {
+		t.Errorf("AllLatest() = %v, want [notes term]", got)
+	}
+
+	// The next write stores the new layout
+	if err := state.SetState("notes", NotVisible); err != nil {
+		t.Fatalf("SetState failed: %v", err)
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &data); err != nil {
+		t.Fatal(err)
+	}
+	if string(data["version"]) != strconv.Itoa(stateSchemaVersion) {
+		t.Errorf("version = %s, want %d", data["version"], stateSchemaVersion)
+	}
+	for _, key := range []string{"tracked", "state", "latest", "groups"} {
+		if _, ok := data[key]; ok {
+			t.Errorf("key %s still written after migrating", key)
+		}
+	}
+	if len(state.FocusStack()) != 1 {
+		t.Errorf("FocusStack() = %v, want the migrated entry", state.FocusStack())
+	}
+}
+
+func TestNewStateManagement_Session(t *testing.T) {
+	for _, name := range []string{"WAYLAND_DISPLAY", "DISPLAY", "BSPWM_SOCKET"} {
+		t.Setenv(name, "")
+	}
+	dir := t.TempDir()
+	open := func(session string) StateManagement {
+		t.Helper()
+		cfg := config.DefaultConfig()
+		cfg.StateBackend = config.StateBackendFile
+		cfg.StateDir = dir
+		cfg.Session = session
+		state, err := NewStateManagement(cfg)
+		if err != nil {
+			t.Fatalf("NewStateManagement() error = %v", err)
+		}
+		return state
+	}
+
+	if err := open(":0").StoreID("term", "0x01"); err != nil {
+		t.Fatalf("StoreID failed: %v", err)
+	}
+	if open(":1").IsTracked("term") {
+		t.Errorf("term tracked in session :1 after tracking it in :0")
+	}
+	if id := open(":0").GetID("term"); id != "0x01" {
+		t.Errorf("GetID() in session :0 = %s, want 0x01", id)
+	}
+
+	// Without an explicit session the display is used
+	t.Setenv("DISPLAY", ":1")
+	if open("").IsTracked("term") {
+		t.Errorf("term tracked in the detected session")
+	}
+	if err := open("").StoreID("term", "0x02"); err != nil {
+		t.Fatalf("StoreID failed: %v", err)
+	}
+	if id := open(":0").GetID("term"); id != "0x01" {
+		t.Errorf("GetID() in session :0 = %s, want 0x01", id)
+	}
+}
+
+func TestNewStateManagement_AdoptsLegacyState(t *testing.T) {
+	dir := t.TempDir()
+	legacy := filepath.Join(dir, "state.json")
+	if err := os.WriteFile(legacy, []byte(`{"tracked": {"term": "0x01"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	open := func(session string) StateManagement {
+		t.Helper()
+		cfg := config.DefaultConfig()
+		cfg.StateBackend = config.StateBackendFile
+		cfg.StateDir = dir
+		cfg.Session = session
+		state, err := NewStateManagement(cfg)
+		if err != nil {
+			t.Fatalf("NewStateManagement() error = %v", err)
+		}
+		return state
+	}
+
+	if id := open(":0").GetID("term"); id != "0x01" {
+		t.Errorf("GetID() in the first session = %s, want 0x01", id)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Errorf("state file from before sessions still present: %v", err)
+	}
+	if open(":1").IsTracked("term") {
+		t.Errorf("term tracked in a second session as well")
+	}
+	if id := open(":0").GetID("term"); id != "0x01" {
+		t.Errorf("GetID() after reopening = %s, want 0x01", id)
+	}
+}
@@ -0,0 +1,94 @@
+package manager
+
+import "log"
+
+// focusStackSize caps the focus stack so windows that are shown but never
+// hidden again don't grow it forever
+const focusStackSize = 16
+
+// RememberFocus records id as the window to return focus to once t is
+// hidden again. Showing t again replaces its earlier entry, so the stack
+// follows the order windows were last shown in.
+func (t *Tracked) RememberFocus(id string) error {
+	log.Printf("Remembering focus %s for window %s", id, t.Name)
+	if err := t.StateMgr.StorePrevID(id); err != nil {
+		return err
+	}
+	stack := withoutFocusEntry(t.StateMgr.FocusStack(), t.Name)
+	stack = append(stack, FocusEntry{Name: t.Name, ID: id})
+	if len(stack) > focusStackSize {
+		stack = stack[len(stack)-focusStackSize:]
+	}
+	return t.StateMgr.SetFocusStack(stack)
+}
+
+// RestoreFocus pops t's entry from the focus stack and focuses the window
+// that had focus when t was shown. If that window is gone, hidden or is t
+// itself, the entries below it are tried in turn, so nested scratchpads
+// hand focus back in the order they were opened. Windows shown from t
+// inherit its entry and return focus to where t came from instead.
+func (t *Tracked) RestoreFocus() error {
+	own := t.ID()
+	stack := t.StateMgr.FocusStack()
+	index := -1
+	for i, entry := range stack {
+		if entry.Name == t.Name {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil
+	}
+	candidates := make([]string, 0, index+1)
+	for i := index; i >= 0; i-- {
+		candidates = append(candidates, stack[i].ID)
+	}
+	rest := append(stack[:index:index], stack[index+1:]...)
+	for i := index; i < len(rest); i++ {
+		if rest[i].ID == own {
+			rest[i].ID = stack[index].ID
+		}
+	}
+	if err := t.StateMgr.SetFocusStack(rest); err != nil {
+		return err
+	}
+	if !t.App.RestoresFocus() {
+		return nil
+	}
+
+	hidden := make(map[string]bool)
+	for _, record := range t.StateMgr.AllHidden() {
+		hidden[record.ID] = true
+	}
+	for _, id := range candidates {
+		if id == "" || id == own || hidden[id] || !t.WM.StillAlive(id) {
+			continue
+		}
+		log.Printf("Restoring focus to %s after hiding %s", id, t.Name)
+		return t.WM.Focus(id)
+	}
+	return nil
+}
+
+// moveFocusEntry hands from's focus stack entry over to to, used when
+// cycling replaces one visible window with another
+func moveFocusEntry(state StateManagement, from, to string) error {
+	stack := withoutFocusEntry(state.FocusStack(), to)
+	for i := range stack {
+		if stack[i].Name == from {
+			stack[i].Name = to
+		}
+	}
+	return state.SetFocusStack(stack)
+}
+
+// withoutFocusEntry returns stack without the entries for name
+func withoutFocusEntry(stack []FocusEntry, name string) []FocusEntry {
+	kept := stack[:0:0]
+	for _, entry := range stack {
+		if entry.Name != name {
+			kept = append(kept, entry)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,76 @@
+package manager
+
+import (
+	"log"
+	"sort"
+)
+
+// GroupsOf returns the groups name belongs to, configured or assigned with
+// the group option
+func (m *Manager) GroupsOf(name string) []string {
+	return mergeGroups(m.Config.GroupsOf(name), m.StateMgr.Groups(name))
+}
+
+// GroupMembers returns the tracked names in group, sorted
+func (m *Manager) GroupMembers(group string) []string {
+	var members []string
+	for _, record := range m.StateMgr.Windows() {
+		if record.ID == "" {
+			continue
+		}
+		for _, g := range mergeGroups(m.Config.GroupsOf(record.Name), record.Groups) {
+			if g == group {
+				members = append(members, record.Name)
+				break
+			}
+		}
+	}
+	sort.Strings(members)
+	return members
+}
+
+// ShowGroup shows every hidden window in group. The focused window before
+// the first one is shown is remembered as the previous window.
+func (m *Manager) ShowGroup(group string) error {
+	focused := m.WM.GetFocusedID()
+	for _, name := range m.GroupMembers(group) {
+		tracked := m.newTracked(name, TypeFocused, false)
+		if tracked.State() != NotVisible {
+			continue
+		}
+		if err := tracked.RememberFocus(focused); err != nil {
+			return err
+		}
+		if err := tracked.ShowAndUpdate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HideGroup hides every visible window in group
+func (m *Manager) HideGroup(group string) error {
+	for _, name := range m.GroupMembers(group) {
+		tracked := m.newTracked(name, TypeFocused, false)
+		if tracked.State() != Visible {
+			continue
+		}
+		if err := tracked.HideAndUpdate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ToggleGroup hides group if any of its windows is visible and shows it
+// otherwise
+func (m *Manager) ToggleGroup(group string) error {
+	for _, name := range m.GroupMembers(group) {
+		if m.newTracked(name, TypeFocused, false).State() == Visible {
+			log.Printf("Group %s has visible windows, hiding", group)
+			return m.HideGroup(group)
+		}
+	}
+	log.Printf("Group %s is hidden, showing", group)
+	return m.ShowGroup(group)
+}
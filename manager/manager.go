@@ -2,7 +2,10 @@ package manager
 
 import (
 	"fmt"
-	"os/exec"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/hellola/startorswitch/config"
@@ -25,7 +28,7 @@ type Manager struct {
 
 // NewManager creates a new Manager instance
 func NewManager(cfg *config.Config, wmIntegration wm.WMIntegration) (*Manager, error) {
-	stateMgr, err := NewRedisStateManagement(cfg.RedisAddr)
+	stateMgr, err := NewStateManagement(cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -37,8 +40,42 @@ func NewManager(cfg *config.Config, wmIntegration wm.WMIntegration) (*Manager, e
 	}, nil
 }
 
-// Go processes the command
+// NewStateManagement creates the state backend selected in the configuration
+func NewStateManagement(cfg *config.Config) (StateManagement, error) {
+	switch cfg.StateBackend {
+	case config.StateBackendRedis:
+		return NewRedisStateManagement(cfg)
+	case config.StateBackendFile, "":
+		dir := cfg.StateDir
+		if dir == "" {
+			dir = config.DefaultStateDir()
+		}
+		if session := cfg.SessionKey(); session != "" {
+			sessionDir := filepath.Join(dir, session)
+			if err := adoptLegacyState(dir, sessionDir); err != nil {
+				return nil, fmt.Errorf("moving state into session %s: %v", session, err)
+			}
+			dir = sessionDir
+		}
+		return NewFileStateManagement(dir)
+	default:
+		return nil, fmt.Errorf("unsupported state backend: %s", cfg.StateBackend)
+	}
+}
+
+// Go processes the command while holding the state lock, so invocations
+// running at the same time can't interleave their reads and writes
 func (m *Manager) Go(cmd Command) error {
+	unlock, err := m.StateMgr.Lock()
+	if err != nil {
+		return fmt.Errorf("locking state: %v", err)
+	}
+	defer unlock()
+	return m.run(cmd)
+}
+
+// run processes the command, the caller holding the state lock
+func (m *Manager) run(cmd Command) error {
 	if cmd.Mode == "r" || cmd.Mode == "reset" {
 		return m.StateMgr.ResetAll()
 	}
@@ -65,6 +102,33 @@ func (m *Manager) Go(cmd Command) error {
 	case "s", "show-all":
 		windowType = TypeShowAll
 		return m.ShowAllHidden()
+	case "show":
+		if cmd.Name == "" {
+			return fmt.Errorf("name is required for mode: %s", cmd.Mode)
+		}
+		return m.ShowTracked(cmd.Name, cmd.Options["focus"] == "true")
+	case "next", "prev":
+		step := 1
+		if cmd.Mode == "prev" {
+			step = -1
+		}
+		wrap := m.Config.CycleWraps()
+		if value, ok := cmd.Options["wrap"]; ok {
+			wrap = value == "true"
+		}
+		return m.Cycle(step, wrap)
+	case "group-show", "group-hide", "group-toggle":
+		if cmd.Name == "" {
+			return fmt.Errorf("group is required for mode: %s", cmd.Mode)
+		}
+		switch cmd.Mode {
+		case "group-show":
+			return m.ShowGroup(cmd.Name)
+		case "group-hide":
+			return m.HideGroup(cmd.Name)
+		default:
+			return m.ToggleGroup(cmd.Name)
+		}
 	default:
 		return fmt.Errorf("unknown command: %s", cmd.Mode)
 	}
@@ -75,7 +139,15 @@ func (m *Manager) Go(cmd Command) error {
 
 	switchTo = cmd.Options["switch_to"] == "true"
 
-	tracked := NewTracked(cmd.Name, windowType, switchTo, m.StateMgr, m.WM)
+	tracked := m.newTracked(cmd.Name, windowType, switchTo)
+	if exclusive, ok := cmd.Options["exclusive"]; ok {
+		value := exclusive == "true"
+		tracked.App.Exclusive = &value
+	}
+	if follow, ok := cmd.Options["follow"]; ok {
+		value := follow == "true"
+		tracked.App.Follow = &value
+	}
 
 	if windowType == TypeClean {
 		return tracked.Destroy()
@@ -85,6 +157,12 @@ func (m *Manager) Go(cmd Command) error {
 		return err
 	}
 
+	if groups := cmd.Options["group"]; groups != "" {
+		if err := m.StateMgr.AddToGroups(cmd.Name, strings.Split(groups, ",")...); err != nil {
+			return err
+		}
+	}
+
 	if err := tracked.ShowOrHide(); err != nil {
 		return err
 	}
@@ -92,27 +170,53 @@ func (m *Manager) Go(cmd Command) error {
 	return m.HandleOptions(tracked.State(), tracked.ID(), cmd.Options)
 }
 
-// HandleOptions processes command options
+// newTracked creates a Tracked for name using the configured app and
+// groups. Every Tracked the manager acts on is created here, including the
+// ones a Tracked creates for other windows.
+func (m *Manager) newTracked(name string, windowType WindowType, switchTo bool) *Tracked {
+	tracked := NewTracked(name, windowType, switchTo, m.StateMgr, m.WM)
+	tracked.App = m.Config.App(name)
+	tracked.GroupsOf = m.GroupsOf
+	tracked.Other = func(name string) *Tracked {
+		return m.newTracked(name, TypeFocused, false)
+	}
+	return tracked
+}
+
+// HandleOptions processes command options. top_padding is applied to the
+// focused monitor while the window is hidden and reset when it is shown,
+// mods is a comma separated list of wm.Modifier names switched on for the
+// window. Both fail with wm.ErrUnsupported if the window manager can't do
+// them.
 func (m *Manager) HandleOptions(state WindowState, nodeID string, options map[string]string) error {
-	for key, value := range options {
-		switch key {
-		case "top_padding":
-			cmd := "bspc config -m HDMI-1-1 top_padding "
-			if state == Visible {
-				cmd += "0"
-			} else {
-				cmd += value
+	if value, ok := options["top_padding"]; ok {
+		pixels, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid top_padding %q: %v", value, err)
+		}
+		padder, ok := m.WM.(wm.Padder)
+		if !ok {
+			return fmt.Errorf("top_padding: %w", wm.ErrUnsupported)
+		}
+		if state == Visible {
+			pixels = 0
+		}
+		if err := padder.SetTopPadding(pixels); err != nil {
+			return err
+		}
+	}
+	if value := options["mods"]; value != "" {
+		modifiable, ok := m.WM.(wm.Modifiable)
+		if !ok {
+			return fmt.Errorf("mods: %w", wm.ErrUnsupported)
+		}
+		for _, name := range strings.Split(value, ",") {
+			mod, err := wm.ParseModifier(strings.TrimSpace(name))
+			if err != nil {
+				return err
 			}
-			return exec.Command("sh", "-c", cmd).Run()
-		case "mods":
-			for _, mod := range strings.Split(value, ",") {
-				switch mod {
-				case "sticky":
-					cmd := fmt.Sprintf("bspc node %s --flag sticky", nodeID)
-					if err := exec.Command("sh", "-c", cmd).Run(); err != nil {
-						return err
-					}
-				}
+			if err := modifiable.SetModifier(nodeID, mod, true); err != nil {
+				return err
 			}
 		}
 	}
@@ -123,7 +227,7 @@ func (m *Manager) HandleOptions(state WindowState, nodeID string, options map[st
 func (m *Manager) ShowAllHidden() error {
 	hidden := m.StateMgr.AllHidden()
 	for _, h := range hidden {
-		tracked := NewTracked(h.Name, TypeFocused, false, m.StateMgr, m.WM)
+		tracked := m.newTracked(h.Name, TypeFocused, false)
 		if err := tracked.ShowAndUpdate(); err != nil {
 			return err
 		}
@@ -131,17 +235,61 @@ func (m *Manager) ShowAllHidden() error {
 	return nil
 }
 
-// HideAllTracked hides all tracked windows
-func (m *Manager) HideAllTracked() error {
-	all := m.StateMgr.AllTracked()
-	for name := range all {
-		if name == "prev" {
-			continue
+// ShowTracked shows the tracked window name if it is hidden, leaving it
+// alone otherwise. With focus set the window is focused as well, whether it
+// was hidden or not, so it is never hidden either way.
+func (m *Manager) ShowTracked(name string, focus bool) error {
+	if !m.StateMgr.IsTracked(name) {
+		return fmt.Errorf("not tracked: %s", name)
+	}
+	tracked := m.newTracked(name, TypeFocused, false)
+	if tracked.State() == NotVisible {
+		if err := tracked.RememberFocus(m.WM.GetFocusedID()); err != nil {
+			return err
 		}
-		tracked := NewTracked(name, TypeFocused, false, m.StateMgr, m.WM)
+		if tracked.App.IsExclusive() {
+			if err := tracked.HideOthers(); err != nil {
+				return err
+			}
+		}
+		if err := tracked.ShowAndUpdate(); err != nil {
+			return err
+		}
+	}
+	if focus && !tracked.IsFocused() {
+		return tracked.Focus()
+	}
+	return nil
+}
+
+// HideAllTracked hides all tracked windows and hands focus back to the
+// window that had it before the first of them was shown
+func (m *Manager) HideAllTracked() error {
+	var visible []*Tracked
+	for name := range m.StateMgr.AllTracked() {
+		tracked := m.newTracked(name, TypeFocused, false)
+		wasVisible := tracked.State() == Visible
 		if err := tracked.HideAndUpdate(); err != nil {
 			return err
 		}
+		if wasVisible {
+			visible = append(visible, tracked)
+		}
+	}
+
+	// Unwind the most recently shown window first, so the last focus
+	// restored is the one from before any of them was shown
+	position := make(map[string]int)
+	for i, entry := range m.StateMgr.FocusStack() {
+		position[entry.Name] = i + 1
+	}
+	sort.Slice(visible, func(i, j int) bool {
+		return position[visible[i].Name] > position[visible[j].Name]
+	})
+	for _, tracked := range visible {
+		if err := tracked.RestoreFocus(); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -155,7 +303,7 @@ func (m *Manager) HideOrShowLatest() error {
 	if len(latest) == 0 {
 		return nil
 	}
-	tracked := NewTracked(latest, TypeFocused, false, m.StateMgr, m.WM)
+	tracked := m.newTracked(latest, TypeFocused, false)
 	return tracked.ToggleAndUpdate()
 }
 
@@ -164,12 +312,52 @@ func (m *Manager) HideTrackedFocused() error {
 	focused := m.WM.GetFocusedID()
 	all := m.StateMgr.AllTracked()
 	for name, id := range all {
-		if name == "prev" {
+		if id == focused {
+			tracked := m.newTracked(name, TypeFocused, false)
+			if err := tracked.HideAndUpdate(); err != nil {
+				return err
+			}
+			return tracked.RestoreFocus()
+		}
+	}
+	return nil
+}
+
+// Reconcile updates the state after a tracked window was closed, shown or
+// hidden outside of startorswitch, so the next toggle acts on what is
+// actually on screen
+func (m *Manager) Reconcile(event wm.Event) error {
+	unlock, err := m.StateMgr.Lock()
+	if err != nil {
+		return fmt.Errorf("locking state: %v", err)
+	}
+	defer unlock()
+	for _, record := range m.StateMgr.Windows() {
+		name := record.Name
+		if record.ID == "" || record.ID != event.NodeID {
 			continue
 		}
-		if id == focused {
-			tracked := NewTracked(name, TypeFocused, false, m.StateMgr, m.WM)
-			return tracked.HideAndUpdate()
+		log.Printf("Reconciling %s (%s) after event %v", name, record.ID, event.Type)
+		switch event.Type {
+		case wm.EventClosed:
+			if err := m.StateMgr.DestroyID(name); err != nil {
+				return err
+			}
+			if err := m.StateMgr.RemoveFromLatest(name); err != nil {
+				return err
+			}
+		case wm.EventShown:
+			if record.State != Visible {
+				if err := m.StateMgr.SetState(name, Visible); err != nil {
+					return err
+				}
+			}
+		case wm.EventHidden:
+			if record.State != NotVisible {
+				if err := m.StateMgr.SetState(name, NotVisible); err != nil {
+					return err
+				}
+			}
 		}
 	}
 	return nil
@@ -0,0 +1,1132 @@
+package manager
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/hellola/startorswitch/config"
+	"github.com/hellola/startorswitch/wm"
+	"github.com/hellola/startorswitch/wm/wmtest"
+)
+
+func newTestManager() (*Manager, *MemoryStateManagement, *wmtest.Fake) {
+	state := NewMemoryStateManagement()
+	fake := wmtest.NewFake()
+	return &Manager{
+		StateMgr: state,
+		WM:       fake,
+		Config:   config.DefaultConfig(),
+	}, state, fake
+}
+
+// track registers name as a tracked window with the given id and state
+func track(t *testing.T, state StateManagement, name, id string, windowState WindowState) {
+	t.Helper()
+	if err := state.StoreID(name, id); err != nil {
+		t.Fatalf("StoreID failed: %v", err)
+	}
+	if err := state.SetState(name, windowState); err != nil {
+		t.Fatalf("SetState failed: %v", err)
+	}
+}
+
+func TestManager_Go(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake)
+		cmd     Command
+		wantErr bool
+		check   func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake)
+	}{
+		{
+			name: "focus tracks and hides the focused window",
+			setup: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				fake.SetFocused("0x01")
+			},
+			cmd: Command{Mode: "f", Name: "term"},
+			check: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				if id := state.GetID("term"); id != "0x01" {
+					t.Errorf("GetID() = %s, want 0x01", id)
+				}
+				if got := state.GetState("0x01"); got != NotVisible {
+					t.Errorf("GetState() = %v, want %v", got, NotVisible)
+				}
+				if !fake.IsHidden("0x01") {
+					t.Errorf("window 0x01 not hidden")
+				}
+			},
+		},
+		{
+			name: "focus shows a hidden tracked window and remembers the previous one",
+			setup: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				fake.SetFocused("0x09")
+				track(t, state, "term", "0x01", NotVisible)
+			},
+			cmd: Command{Mode: "focus", Name: "term"},
+			check: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				if got := state.GetState("0x01"); got != Visible {
+					t.Errorf("GetState() = %v, want %v", got, Visible)
+				}
+				if prev := state.LoadPrevID(); prev != "0x09" {
+					t.Errorf("LoadPrevID() = %s, want 0x09", prev)
+				}
+				if latest, _ := state.LatestShown(""); latest != "term" {
+					t.Errorf("LatestShown() = %s, want term", latest)
+				}
+			},
+		},
+		{
+			name: "switch_to focuses a visible unfocused window instead of hiding it",
+			setup: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				fake.SetFocused("0x09")
+				track(t, state, "term", "0x01", Visible)
+			},
+			cmd: Command{Mode: "f", Name: "term", Options: map[string]string{"switch_to": "true"}},
+			check: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				if got := fake.CallsTo("Focus"); !reflect.DeepEqual(got, []string{"0x01"}) {
+					t.Errorf("Focus calls = %v, want [0x01]", got)
+				}
+				if got := state.GetState("0x01"); got != Visible {
+					t.Errorf("GetState() = %v, want %v", got, Visible)
+				}
+			},
+		},
+		{
+			name: "application starts and tracks the application window",
+			setup: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				fake.AddApp("myapp", "0x02")
+			},
+			cmd: Command{Mode: "a", Name: "myapp"},
+			check: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				if id := state.GetID("myapp"); id != "0x02" {
+					t.Errorf("GetID() = %s, want 0x02", id)
+				}
+			},
+		},
+		{
+			name: "application restarts a window that is no longer alive",
+			setup: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				track(t, state, "myapp", "0x02", NotVisible)
+				fake.AddApp("myapp", "0x03")
+			},
+			cmd: Command{Mode: "application", Name: "myapp"},
+			check: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				if id := state.GetID("myapp"); id != "0x03" {
+					t.Errorf("GetID() = %s, want 0x03", id)
+				}
+			},
+		},
+		{
+			name:    "application fails when the window cannot be found",
+			cmd:     Command{Mode: "a", Name: "missing"},
+			wantErr: true,
+		},
+		{
+			name: "clean removes the tracked window",
+			setup: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				track(t, state, "term", "0x01", Visible)
+			},
+			cmd: Command{Mode: "c", Name: "term"},
+			check: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				if state.IsTracked("term") {
+					t.Errorf("term still tracked")
+				}
+				if len(fake.Calls()) != 0 {
+					t.Errorf("unexpected WM calls: %v", fake.Calls())
+				}
+			},
+		},
+		{
+			name: "hide hides the focused tracked window",
+			setup: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				track(t, state, "term", "0x01", Visible)
+				track(t, state, "notes", "0x02", Visible)
+				fake.SetFocused("0x02")
+			},
+			cmd: Command{Mode: "h"},
+			check: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				if got := fake.CallsTo("Hide"); !reflect.DeepEqual(got, []string{"0x02"}) {
+					t.Errorf("Hide calls = %v, want [0x02]", got)
+				}
+				if got := state.GetState("0x02"); got != NotVisible {
+					t.Errorf("GetState() = %v, want %v", got, NotVisible)
+				}
+			},
+		},
+		{
+			name: "hide ignores untracked focused windows",
+			setup: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				track(t, state, "term", "0x01", Visible)
+				fake.SetFocused("0x09")
+			},
+			cmd: Command{Mode: "hide"},
+			check: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				if got := fake.CallsTo("Hide"); len(got) != 0 {
+					t.Errorf("Hide calls = %v, want none", got)
+				}
+			},
+		},
+		{
+			name: "hide-latest hides the most recently shown window",
+			setup: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				track(t, state, "term", "0x01", Visible)
+				track(t, state, "notes", "0x02", Visible)
+				state.LatestShown("term")
+				state.LatestShown("notes")
+			},
+			cmd: Command{Mode: "hl"},
+			check: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				if got := fake.CallsTo("Hide"); !reflect.DeepEqual(got, []string{"0x02"}) {
+					t.Errorf("Hide calls = %v, want [0x02]", got)
+				}
+				if latest, _ := state.LatestShown(""); latest != "term" {
+					t.Errorf("LatestShown() = %s, want term", latest)
+				}
+			},
+		},
+		{
+			name: "hide-latest shows the latest window when it is hidden",
+			setup: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				track(t, state, "term", "0x01", NotVisible)
+				state.LatestShown("term")
+			},
+			cmd: Command{Mode: "hide-latest"},
+			check: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				if got := fake.CallsTo("Show"); !reflect.DeepEqual(got, []string{"0x01"}) {
+					t.Errorf("Show calls = %v, want [0x01]", got)
+				}
+			},
+		},
+		{
+			name: "hide-latest does nothing without history",
+			cmd:  Command{Mode: "hl"},
+			check: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				if len(fake.Calls()) != 0 {
+					t.Errorf("unexpected WM calls: %v", fake.Calls())
+				}
+			},
+		},
+		{
+			name: "hide-all hides every tracked window except prev",
+			setup: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				track(t, state, "term", "0x01", Visible)
+				track(t, state, "notes", "0x02", Visible)
+				state.StorePrevID("0x09")
+			},
+			cmd: Command{Mode: "ha"},
+			check: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				if got := len(fake.CallsTo("Hide")); got != 2 {
+					t.Errorf("Hide calls = %d, want 2", got)
+				}
+				if fake.IsHidden("0x09") {
+					t.Errorf("prev window was hidden")
+				}
+				if got := len(state.AllHidden()); got != 2 {
+					t.Errorf("AllHidden() has %d entries, want 2", got)
+				}
+			},
+		},
+		{
+			name: "show-all shows every hidden window",
+			setup: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				track(t, state, "term", "0x01", NotVisible)
+				track(t, state, "notes", "0x02", NotVisible)
+				track(t, state, "mail", "0x03", Visible)
+			},
+			cmd: Command{Mode: "s"},
+			check: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				if got := len(fake.CallsTo("Show")); got != 2 {
+					t.Errorf("Show calls = %d, want 2", got)
+				}
+				if hidden := state.AllHidden(); len(hidden) != 0 {
+					t.Errorf("AllHidden() = %v, want none", hidden)
+				}
+			},
+		},
+		{
+			name: "show-all stops at the first WM error",
+			setup: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				track(t, state, "term", "0x01", NotVisible)
+				fake.FailOn("Show", errors.New("boom"))
+			},
+			cmd:     Command{Mode: "show-all"},
+			wantErr: true,
+		},
+		{
+			name: "show shows a hidden tracked window",
+			setup: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				fake.SetFocused("0x09")
+				track(t, state, "term", "0x01", NotVisible)
+			},
+			cmd: Command{Mode: "show", Name: "term"},
+			check: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				if got := fake.CallsTo("Show"); !reflect.DeepEqual(got, []string{"0x01"}) {
+					t.Errorf("Show calls = %v, want [0x01]", got)
+				}
+				if prev := state.LoadPrevID(); prev != "0x09" {
+					t.Errorf("LoadPrevID() = %s, want 0x09", prev)
+				}
+			},
+		},
+		{
+			name: "show leaves a visible window alone",
+			setup: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				track(t, state, "term", "0x01", Visible)
+			},
+			cmd: Command{Mode: "show", Name: "term"},
+			check: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				if len(fake.Calls()) != 0 {
+					t.Errorf("unexpected WM calls: %v", fake.Calls())
+				}
+			},
+		},
+		{
+			name: "show with focus focuses a visible window instead of hiding it",
+			setup: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				fake.SetFocused("0x09")
+				track(t, state, "term", "0x01", Visible)
+			},
+			cmd: Command{Mode: "show", Name: "term", Options: map[string]string{"focus": "true"}},
+			check: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				if got := fake.CallsTo("Focus"); !reflect.DeepEqual(got, []string{"0x01"}) {
+					t.Errorf("Focus calls = %v, want [0x01]", got)
+				}
+				if got := fake.CallsTo("Hide"); len(got) != 0 {
+					t.Errorf("Hide calls = %v, want none", got)
+				}
+			},
+		},
+		{
+			name: "show with focus leaves the focused window alone",
+			setup: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				fake.SetFocused("0x01")
+				track(t, state, "term", "0x01", Visible)
+			},
+			cmd: Command{Mode: "show", Name: "term", Options: map[string]string{"focus": "true"}},
+			check: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				if got := fake.CallsTo("Hide"); len(got) != 0 {
+					t.Errorf("Hide calls = %v, want none", got)
+				}
+				if got := state.GetState("0x01"); got != Visible {
+					t.Errorf("GetState() = %v, want %v", got, Visible)
+				}
+			},
+		},
+		{
+			name:    "show fails for untracked names",
+			cmd:     Command{Mode: "show", Name: "term"},
+			wantErr: true,
+		},
+		{
+			name: "reset forgets all tracked windows",
+			setup: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				track(t, state, "term", "0x01", Visible)
+			},
+			cmd: Command{Mode: "r"},
+			check: func(t *testing.T, state *MemoryStateManagement, fake *wmtest.Fake) {
+				if len(state.AllTracked()) != 0 {
+					t.Errorf("AllTracked() = %v, want empty", state.AllTracked())
+				}
+			},
+		},
+		{
+			name:    "name is required for focus",
+			cmd:     Command{Mode: "f"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown mode",
+			cmd:     Command{Mode: "bogus", Name: "term"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, state, fake := newTestManager()
+			if tt.setup != nil {
+				tt.setup(t, state, fake)
+			}
+			fake.ResetCalls()
+
+			err := m.Go(tt.cmd)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Go() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.check != nil {
+				tt.check(t, state, fake)
+			}
+		})
+	}
+}
+
+func TestTracked_ShowOrHide(t *testing.T) {
+	tests := []struct {
+		name      string
+		state     WindowState
+		switchTo  bool
+		focused   string
+		wantState WindowState
+		wantCalls []wmtest.Call
+	}{
+		{
+			name:      "untracked state counts as visible and hides",
+			state:     Errored,
+			focused:   "0x01",
+			wantState: NotVisible,
+			wantCalls: []wmtest.Call{{Method: "Hide", NodeID: "0x01"}},
+		},
+		{
+			name:      "visible hides",
+			state:     Visible,
+			focused:   "0x01",
+			wantState: NotVisible,
+			wantCalls: []wmtest.Call{{Method: "Hide", NodeID: "0x01"}},
+		},
+		{
+			name:      "visible and focused with switch_to hides",
+			state:     Visible,
+			switchTo:  true,
+			focused:   "0x01",
+			wantState: NotVisible,
+			wantCalls: []wmtest.Call{{Method: "Hide", NodeID: "0x01"}},
+		},
+		{
+			name:      "visible and unfocused with switch_to focuses",
+			state:     Visible,
+			switchTo:  true,
+			focused:   "0x09",
+			wantState: Visible,
+			wantCalls: []wmtest.Call{{Method: "Focus", NodeID: "0x01"}},
+		},
+		{
+			name:      "hidden shows",
+			state:     NotVisible,
+			focused:   "0x09",
+			wantState: Visible,
+			wantCalls: []wmtest.Call{{Method: "Show", NodeID: "0x01"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := NewMemoryStateManagement()
+			fake := wmtest.NewFake()
+			fake.SetFocused(tt.focused)
+			state.StoreID("term", "0x01")
+			if tt.state != Errored {
+				state.SetState("term", tt.state)
+			}
+
+			tracked := NewTracked("term", TypeFocused, tt.switchTo, state, fake)
+			if err := tracked.ShowOrHide(); err != nil {
+				t.Fatalf("ShowOrHide() error = %v", err)
+			}
+			if got := state.GetState("0x01"); got != tt.wantState {
+				t.Errorf("GetState() = %v, want %v", got, tt.wantState)
+			}
+			if got := fake.Calls(); !reflect.DeepEqual(got, tt.wantCalls) {
+				t.Errorf("calls = %v, want %v", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+// minimizingWM reports the windows in hidden as minimized, the way the EWMH
+// backend reads _NET_WM_STATE_HIDDEN
+type minimizingWM struct {
+	*wmtest.Fake
+	hidden map[string]bool
+}
+
+func (w minimizingWM) IsHidden(nodeID string) (bool, error) {
+	return w.hidden[nodeID], nil
+}
+
+func (w minimizingWM) Show(nodeID string) error {
+	delete(w.hidden, nodeID)
+	return w.Fake.Show(nodeID)
+}
+
+func TestManager_GoCorrectsMinimizedState(t *testing.T) {
+	m, state, fake := newTestManager()
+	m.WM = minimizingWM{Fake: fake, hidden: map[string]bool{"0x01": true}}
+	track(t, state, "term", "0x01", Visible)
+
+	// Minimized from the taskbar, so the toggle shows it instead of hiding
+	if err := m.Go(Command{Mode: "f", Name: "term"}); err != nil {
+		t.Fatalf("Go() error = %v", err)
+	}
+	if got := fake.CallsTo("Show"); !reflect.DeepEqual(got, []string{"0x01"}) {
+		t.Errorf("Show calls = %v, want [0x01]", got)
+	}
+	if got := state.GetState("0x01"); got != Visible {
+		t.Errorf("GetState() = %v, want %v", got, Visible)
+	}
+}
+
+func TestManager_GoResolvesConfiguredApps(t *testing.T) {
+	m, state, fake := newTestManager()
+	m.Config.Apps = map[string]config.App{
+		"term": {
+			Command: "kitty",
+			Args:    []string{"--class", "scratch-term"},
+			Match:   config.Match{Class: "scratch-term"},
+		},
+	}
+	fake.AddApp("term", "0x05")
+	fake.AddWindow(wm.Window{ID: "0x05", Class: "scratch-term", Workspace: "3"})
+
+	if err := m.Go(Command{Mode: "a", Name: "term"}); err != nil {
+		t.Fatalf("Go() error = %v", err)
+	}
+	launched := fake.Launched()
+	if len(launched) != 1 {
+		t.Fatalf("Launched() = %v, want one app", launched)
+	}
+	if launched[0].Command != "kitty" || launched[0].Match.Class != "scratch-term" {
+		t.Errorf("Launched()[0] = %+v, want the configured term app", launched[0])
+	}
+	if id := state.GetID("term"); id != "0x05" {
+		t.Errorf("GetID() = %s, want 0x05", id)
+	}
+	record, ok := state.Window("term")
+	if !ok {
+		t.Fatalf("Window(term) not found")
+	}
+	if record.Type != TypeApplication || record.Command != "kitty --class scratch-term" || record.Workspace != "3" {
+		t.Errorf("Window(term) = %+v, want the kitty application on workspace 3", record)
+	}
+	if record.TrackedAt.IsZero() || record.HiddenAt.IsZero() {
+		t.Errorf("Window(term) TrackedAt, HiddenAt = %v, %v, want both set", record.TrackedAt, record.HiddenAt)
+	}
+}
+
+func TestManager_Reconcile(t *testing.T) {
+	m, state, _ := newTestManager()
+	track(t, state, "term", "0x01", NotVisible)
+	track(t, state, "notes", "0x02", Visible)
+	state.LatestShown("notes")
+	state.StorePrevID("0x02")
+
+	if err := m.Reconcile(wm.Event{Type: wm.EventShown, NodeID: "0x01"}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if got := state.GetState("0x01"); got != Visible {
+		t.Errorf("GetState(0x01) = %v, want %v", got, Visible)
+	}
+
+	if err := m.Reconcile(wm.Event{Type: wm.EventHidden, NodeID: "0x01"}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if got := state.GetState("0x01"); got != NotVisible {
+		t.Errorf("GetState(0x01) = %v, want %v", got, NotVisible)
+	}
+
+	if err := m.Reconcile(wm.Event{Type: wm.EventClosed, NodeID: "0x02"}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if state.IsTracked("notes") {
+		t.Errorf("notes still tracked after its window closed")
+	}
+	if state.LatestCount() != 0 {
+		t.Errorf("LatestCount() = %d, want 0", state.LatestCount())
+	}
+	if prev := state.LoadPrevID(); prev != "0x02" {
+		t.Errorf("LoadPrevID() = %s, want 0x02", prev)
+	}
+
+	if err := m.Reconcile(wm.Event{Type: wm.EventClosed, NodeID: "0x09"}); err != nil {
+		t.Fatalf("Reconcile() of an untracked window error = %v", err)
+	}
+	if !state.IsTracked("term") {
+		t.Errorf("term no longer tracked")
+	}
+}
+
+func TestManager_Status(t *testing.T) {
+	m, state, fake := newTestManager()
+	track(t, state, "term", "0x01", Visible)
+	track(t, state, "notes", "0x02", NotVisible)
+	track(t, state, "gone", "0x03", Visible)
+	state.LatestShown("notes")
+	state.LatestShown("term")
+	state.StorePrevID("0x01")
+	fake.AddWindow(wm.Window{ID: "0x01", Class: "kitty", Title: "htop", Workspace: "1"})
+	fake.AddWindow(wm.Window{ID: "0x02", Class: "Obsidian", Title: "notes", Workspace: "2"})
+	fake.SetFocused("0x01")
+
+	status, err := m.Status()
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	want := []WindowStatus{
+		{Name: "gone", ID: "0x03", State: "visible"},
+		{Name: "notes", ID: "0x02", State: "hidden", Latest: 2, Alive: true, Workspace: "2", Class: "Obsidian", Title: "notes"},
+		{Name: "term", ID: "0x01", State: "visible", Latest: 1, Alive: true, Focused: true, Workspace: "1", Class: "kitty", Title: "htop"},
+	}
+	if !reflect.DeepEqual(status, want) {
+		t.Errorf("Status() = %+v, want %+v", status, want)
+	}
+}
+
+func TestManager_GoExclusive(t *testing.T) {
+	off := false
+	tests := []struct {
+		name      string
+		exclusive bool
+		apps      map[string]config.App
+		options   map[string]string
+		wantHide  []string
+	}{
+		{
+			name:     "not exclusive leaves other windows visible",
+			wantHide: nil,
+		},
+		{
+			name:      "exclusive hides the other visible windows",
+			exclusive: true,
+			wantHide:  []string{"0x02"},
+		},
+		{
+			name:      "per app setting overrides the global one",
+			exclusive: true,
+			apps:      map[string]config.App{"term": {Exclusive: &off}},
+			wantHide:  nil,
+		},
+		{
+			name:     "option overrides the config",
+			options:  map[string]string{"exclusive": "true"},
+			wantHide: []string{"0x02"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, state, fake := newTestManager()
+			m.Config.Exclusive = tt.exclusive
+			m.Config.Apps = tt.apps
+			track(t, state, "term", "0x01", NotVisible)
+			track(t, state, "notes", "0x02", Visible)
+			track(t, state, "mail", "0x03", NotVisible)
+			state.LatestShown("mail")
+			state.LatestShown("notes")
+			fake.ResetCalls()
+
+			if err := m.Go(Command{Mode: "f", Name: "term", Options: tt.options}); err != nil {
+				t.Fatalf("Go() error = %v", err)
+			}
+			if got := fake.CallsTo("Hide"); !reflect.DeepEqual(got, tt.wantHide) {
+				t.Errorf("Hide calls = %v, want %v", got, tt.wantHide)
+			}
+			if got := state.GetState("0x01"); got != Visible {
+				t.Errorf("GetState(0x01) = %v, want %v", got, Visible)
+			}
+			if tt.wantHide != nil {
+				if got := state.GetState("0x02"); got != NotVisible {
+					t.Errorf("GetState(0x02) = %v, want %v", got, NotVisible)
+				}
+				if got := state.AllLatest(); !reflect.DeepEqual(got, []string{"term", "mail"}) {
+					t.Errorf("AllLatest() = %v, want [term mail]", got)
+				}
+			}
+		})
+	}
+}
+
+func TestManager_GoGroups(t *testing.T) {
+	tests := []struct {
+		name     string
+		visible  []string
+		cmd      Command
+		wantShow []string
+		wantHide []string
+	}{
+		{
+			name:     "group-show shows the hidden members",
+			visible:  []string{"mail"},
+			cmd:      Command{Mode: "group-show", Name: "comms"},
+			wantShow: []string{"0x03", "0x01"},
+		},
+		{
+			name:     "group-hide hides the visible members",
+			visible:  []string{"chat", "mail", "term"},
+			cmd:      Command{Mode: "group-hide", Name: "comms"},
+			wantHide: []string{"0x01", "0x02"},
+		},
+		{
+			name:     "group-toggle hides a partly visible group",
+			visible:  []string{"mail"},
+			cmd:      Command{Mode: "group-toggle", Name: "comms"},
+			wantHide: []string{"0x02"},
+		},
+		{
+			name:     "group-toggle shows a hidden group",
+			cmd:      Command{Mode: "group-toggle", Name: "comms"},
+			wantShow: []string{"0x03", "0x01", "0x02"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, state, fake := newTestManager()
+			m.Config.Groups = map[string][]string{"comms": {"chat", "mail"}}
+			ids := map[string]string{"chat": "0x01", "mail": "0x02", "calendar": "0x03", "term": "0x04"}
+			for name, id := range ids {
+				track(t, state, name, id, NotVisible)
+			}
+			for _, name := range tt.visible {
+				state.SetState(name, Visible)
+			}
+			state.AddToGroups("calendar", "comms")
+			fake.ResetCalls()
+
+			if err := m.Go(tt.cmd); err != nil {
+				t.Fatalf("Go() error = %v", err)
+			}
+			if got := fake.CallsTo("Show"); !reflect.DeepEqual(got, tt.wantShow) {
+				t.Errorf("Show calls = %v, want %v", got, tt.wantShow)
+			}
+			if got := fake.CallsTo("Hide"); !reflect.DeepEqual(got, tt.wantHide) {
+				t.Errorf("Hide calls = %v, want %v", got, tt.wantHide)
+			}
+		})
+	}
+}
+
+func TestManager_GoGroupOption(t *testing.T) {
+	m, state, fake := newTestManager()
+	m.Config.Exclusive = true
+	track(t, state, "chat", "0x01", Visible)
+	track(t, state, "term", "0x04", Visible)
+	track(t, state, "mail", "0x02", NotVisible)
+	state.AddToGroups("chat", "comms")
+	fake.ResetCalls()
+
+	if err := m.Go(Command{Mode: "f", Name: "mail", Options: map[string]string{"group": "comms,work"}}); err != nil {
+		t.Fatalf("Go() error = %v", err)
+	}
+	if got := m.GroupsOf("mail"); !reflect.DeepEqual(got, []string{"comms", "work"}) {
+		t.Errorf("GroupsOf(mail) = %v, want [comms work]", got)
+	}
+	// Exclusive only hides the other member of comms, not the ungrouped term
+	if got := fake.CallsTo("Hide"); !reflect.DeepEqual(got, []string{"0x01"}) {
+		t.Errorf("Hide calls = %v, want [0x01]", got)
+	}
+}
+
+func TestManager_GoCycle(t *testing.T) {
+	noWrap := false
+	tests := []struct {
+		name      string
+		visible   string
+		cmds      []Command
+		wrap      *bool
+		wantShown []string
+	}{
+		{
+			name:      "next walks the latest order and then the rest by name",
+			visible:   "notes",
+			cmds:      []Command{{Mode: "next"}, {Mode: "next"}, {Mode: "next"}},
+			wantShown: []string{"0x03", "0x04", "0x01"},
+		},
+		{
+			name:      "next wraps around",
+			visible:   "mail",
+			cmds:      []Command{{Mode: "next"}},
+			wantShown: []string{"0x01"},
+		},
+		{
+			name:      "prev walks backwards",
+			visible:   "notes",
+			cmds:      []Command{{Mode: "prev"}, {Mode: "prev"}},
+			wantShown: []string{"0x01", "0x04"},
+		},
+		{
+			name:      "next without a visible window shows the first",
+			cmds:      []Command{{Mode: "next"}},
+			wantShown: []string{"0x01"},
+		},
+		{
+			name:      "prev without a visible window shows the last",
+			cmds:      []Command{{Mode: "prev"}},
+			wantShown: []string{"0x04"},
+		},
+		{
+			name:    "next stops at the end without wraparound",
+			visible: "mail",
+			wrap:    &noWrap,
+			cmds:    []Command{{Mode: "next"}},
+		},
+		{
+			name:      "wrap option overrides the config",
+			visible:   "mail",
+			wrap:      &noWrap,
+			cmds:      []Command{{Mode: "next", Options: map[string]string{"wrap": "true"}}},
+			wantShown: []string{"0x01"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, state, fake := newTestManager()
+			m.Config.CycleWrap = tt.wrap
+			// latest order: term, notes, then chat and mail by name
+			for name, id := range map[string]string{"term": "0x01", "notes": "0x02", "chat": "0x03", "mail": "0x04"} {
+				track(t, state, name, id, NotVisible)
+			}
+			state.LatestShown("notes")
+			state.LatestShown("term")
+			if tt.visible != "" {
+				state.SetState(tt.visible, Visible)
+			}
+			fake.ResetCalls()
+
+			for _, cmd := range tt.cmds {
+				if err := m.Go(cmd); err != nil {
+					t.Fatalf("Go(%v) error = %v", cmd, err)
+				}
+			}
+			if got := fake.CallsTo("Show"); !reflect.DeepEqual(got, tt.wantShown) {
+				t.Errorf("Show calls = %v, want %v", got, tt.wantShown)
+			}
+			visible := 0
+			for _, id := range state.AllTracked() {
+				if state.GetState(id) == Visible {
+					visible++
+				}
+			}
+			if tt.visible != "" && visible != 1 {
+				t.Errorf("%d windows visible after cycling, want 1", visible)
+			}
+			if got := state.AllLatest(); !reflect.DeepEqual(got, []string{"term", "notes"}) {
+				t.Errorf("AllLatest() = %v, want the order untouched", got)
+			}
+		})
+	}
+}
+
+func TestManager_GoRestoresFocus(t *testing.T) {
+	off := false
+	tests := []struct {
+		name         string
+		restoreFocus *bool
+		apps         map[string]config.App
+		closed       string
+		hide         []string
+		wantFocus    []string
+	}{
+		{
+			name:      "nested windows return focus in order",
+			hide:      []string{"notes", "term"},
+			wantFocus: []string{"0x01", "0x09"},
+		},
+		{
+			name:      "closed windows are skipped",
+			closed:    "0x01",
+			hide:      []string{"notes"},
+			wantFocus: []string{"0x09"},
+		},
+		{
+			name:      "hidden windows are skipped",
+			hide:      []string{"term", "notes"},
+			wantFocus: []string{"0x09", "0x09"},
+		},
+		{
+			name:         "disabled globally",
+			restoreFocus: &off,
+			hide:         []string{"notes", "term"},
+		},
+		{
+			name:      "disabled per app",
+			apps:      map[string]config.App{"term": {RestoreFocus: &off}},
+			hide:      []string{"notes", "term"},
+			wantFocus: []string{"0x01"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, state, fake := newTestManager()
+			m.Config.RestoreFocus = tt.restoreFocus
+			m.Config.Apps = tt.apps
+			track(t, state, "term", "0x01", NotVisible)
+			track(t, state, "notes", "0x02", NotVisible)
+			fake.SetAlive("0x01", true)
+			fake.SetAlive("0x02", true)
+			fake.SetFocused("0x09")
+
+			for _, name := range []string{"term", "notes"} {
+				if err := m.Go(Command{Mode: "f", Name: name}); err != nil {
+					t.Fatalf("Go(show %s) error = %v", name, err)
+				}
+			}
+			if tt.closed != "" {
+				fake.SetAlive(tt.closed, false)
+			}
+			fake.ResetCalls()
+			for _, name := range tt.hide {
+				if err := m.Go(Command{Mode: "f", Name: name}); err != nil {
+					t.Fatalf("Go(hide %s) error = %v", name, err)
+				}
+			}
+			if got := fake.CallsTo("Focus"); !reflect.DeepEqual(got, tt.wantFocus) {
+				t.Errorf("Focus calls = %v, want %v", got, tt.wantFocus)
+			}
+		})
+	}
+}
+
+func TestManager_GoHideAllRestoresFocus(t *testing.T) {
+	m, state, fake := newTestManager()
+	track(t, state, "term", "0x01", NotVisible)
+	track(t, state, "notes", "0x02", NotVisible)
+	fake.SetAlive("0x01", true)
+	fake.SetAlive("0x02", true)
+	fake.SetAlive("0x07", true)
+	fake.SetAlive("0x09", true)
+
+	// term is shown from 0x09, notes later from 0x07
+	fake.SetFocused("0x09")
+	if err := m.Go(Command{Mode: "f", Name: "term"}); err != nil {
+		t.Fatalf("Go(show term) error = %v", err)
+	}
+	fake.SetFocused("0x07")
+	if err := m.Go(Command{Mode: "f", Name: "notes"}); err != nil {
+		t.Fatalf("Go(show notes) error = %v", err)
+	}
+	fake.ResetCalls()
+
+	if err := m.Go(Command{Mode: "ha"}); err != nil {
+		t.Fatalf("Go(hide-all) error = %v", err)
+	}
+	focus := fake.CallsTo("Focus")
+	if len(focus) == 0 || focus[len(focus)-1] != "0x09" {
+		t.Errorf("Focus calls = %v, want the last one on 0x09", focus)
+	}
+	if len(state.FocusStack()) != 0 {
+		t.Errorf("FocusStack() = %v, want empty", state.FocusStack())
+	}
+}
+
+func TestManager_HandleOptions(t *testing.T) {
+	m, _, fake := newTestManager()
+
+	if err := m.HandleOptions(NotVisible, "0x01", map[string]string{"top_padding": "30", "mods": "sticky,above"}); err != nil {
+		t.Fatalf("HandleOptions() error = %v", err)
+	}
+	if got := fake.TopPadding(); got != 30 {
+		t.Errorf("TopPadding() = %d, want 30", got)
+	}
+	for _, mod := range []wm.Modifier{wm.Sticky, wm.Above} {
+		if !fake.HasModifier("0x01", mod) {
+			t.Errorf("HasModifier(0x01, %s) = false, want true", mod)
+		}
+	}
+
+	if err := m.HandleOptions(Visible, "0x01", map[string]string{"top_padding": "30"}); err != nil {
+		t.Fatalf("HandleOptions() error = %v", err)
+	}
+	if got := fake.TopPadding(); got != 0 {
+		t.Errorf("TopPadding() = %d, want 0 while the window is visible", got)
+	}
+
+	if err := m.HandleOptions(Visible, "0x01", map[string]string{"mods": "shaded"}); err == nil {
+		t.Errorf("HandleOptions() with an unknown modifier error = nil")
+	}
+
+	// A backend without the capabilities reports them as unsupported
+	m.WM = struct{ wm.WMIntegration }{fake}
+	for _, options := range []map[string]string{{"mods": "sticky"}, {"top_padding": "30"}} {
+		if err := m.HandleOptions(Visible, "0x01", options); !errors.Is(err, wm.ErrUnsupported) {
+			t.Errorf("HandleOptions(%v) error = %v, want ErrUnsupported", options, err)
+		}
+	}
+}
+
+func TestManager_GoPlacesWindows(t *testing.T) {
+	m, state, fake := newTestManager()
+	geometry := config.Geometry{Width: "100%", Height: "40%", Anchor: "top"}
+	m.Config.Apps = map[string]config.App{"term": {Geometry: &geometry}}
+	track(t, state, "term", "0x01", NotVisible)
+	track(t, state, "notes", "0x02", NotVisible)
+
+	for _, name := range []string{"term", "notes"} {
+		if err := m.Go(Command{Mode: "f", Name: name}); err != nil {
+			t.Fatalf("Go(%s) error = %v", name, err)
+		}
+	}
+	if got := fake.CallsTo("Place"); !reflect.DeepEqual(got, []string{"0x01"}) {
+		t.Errorf("Place calls = %v, want [0x01]", got)
+	}
+	if got, _ := fake.Placed("0x01"); got != geometry {
+		t.Errorf("Placed(0x01) = %+v, want %+v", got, geometry)
+	}
+	if record, _ := state.Window("term"); record.Geometry == nil || *record.Geometry != geometry {
+		t.Errorf("Window(term).Geometry = %v, want %+v", record.Geometry, geometry)
+	}
+
+	// A backend that can't place windows fails instead of ignoring the rule
+	m.WM = struct{ wm.WMIntegration }{fake}
+	state.SetState("term", NotVisible)
+	if err := m.Go(Command{Mode: "f", Name: "term"}); !errors.Is(err, wm.ErrUnsupported) {
+		t.Errorf("Go() error = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestManager_GoFollow(t *testing.T) {
+	on, off := true, false
+	tests := []struct {
+		name       string
+		follow     bool
+		apps       map[string]config.App
+		options    map[string]string
+		wantShow   []string
+		wantFollow []string
+	}{
+		{
+			name:     "summons by default",
+			wantShow: []string{"0x01"},
+		},
+		{
+			name:       "follows when configured",
+			follow:     true,
+			wantFollow: []string{"0x01"},
+		},
+		{
+			name:     "per app setting overrides the global one",
+			follow:   true,
+			apps:     map[string]config.App{"term": {Follow: &off}},
+			wantShow: []string{"0x01"},
+		},
+		{
+			name:       "per app follow",
+			apps:       map[string]config.App{"term": {Follow: &on}},
+			wantFollow: []string{"0x01"},
+		},
+		{
+			name:       "option overrides the config",
+			options:    map[string]string{"follow": "true"},
+			wantFollow: []string{"0x01"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, state, fake := newTestManager()
+			m.Config.Follow = tt.follow
+			m.Config.Apps = tt.apps
+			track(t, state, "term", "0x01", NotVisible)
+			fake.ResetCalls()
+
+			if err := m.Go(Command{Mode: "f", Name: "term", Options: tt.options}); err != nil {
+				t.Fatalf("Go() error = %v", err)
+			}
+			if got := fake.CallsTo("Show"); !reflect.DeepEqual(got, tt.wantShow) {
+				t.Errorf("Show calls = %v, want %v", got, tt.wantShow)
+			}
+			if got := fake.CallsTo("Follow"); !reflect.DeepEqual(got, tt.wantFollow) {
+				t.Errorf("Follow calls = %v, want %v", got, tt.wantFollow)
+			}
+		})
+	}
+
+	// Hiding remembers the workspace to follow the window back to
+	m, state, fake := newTestManager()
+	m.Config.Follow = true
+	track(t, state, "term", "0x01", Visible)
+	fake.AddWindow(wm.Window{ID: "0x01", Workspace: "2"})
+	for i := 0; i < 2; i++ {
+		if err := m.Go(Command{Mode: "f", Name: "term"}); err != nil {
+			t.Fatalf("Go() error = %v", err)
+		}
+	}
+	if got := fake.FollowedTo("0x01"); got != "2" {
+		t.Errorf("FollowedTo(0x01) = %q, want 2", got)
+	}
+
+	m, state, fake = newTestManager()
+	m.WM = struct{ wm.WMIntegration }{fake}
+	m.Config.Follow = true
+	track(t, state, "term", "0x01", NotVisible)
+	if err := m.Go(Command{Mode: "f", Name: "term"}); !errors.Is(err, wm.ErrUnsupported) {
+		t.Errorf("Go() on a backend without Follow error = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestManager_GoConcurrentToggles(t *testing.T) {
+	tests := []struct {
+		name string
+		// managers returns the managers toggling in parallel, sharing state
+		// like separate processes would
+		managers func(t *testing.T, fake *wmtest.Fake) []*Manager
+	}{
+		{
+			name: "memory backend shared in process",
+			managers: func(t *testing.T, fake *wmtest.Fake) []*Manager {
+				state := NewMemoryStateManagement()
+				m := &Manager{StateMgr: state, WM: fake, Config: config.DefaultConfig()}
+				return []*Manager{m, m, m, m}
+			},
+		},
+		{
+			name: "file backend opened by each invocation",
+			managers: func(t *testing.T, fake *wmtest.Fake) []*Manager {
+				dir := t.TempDir()
+				var managers []*Manager
+				for i := 0; i < 4; i++ {
+					state, err := NewFileStateManagement(dir)
+					if err != nil {
+						t.Fatalf("NewFileStateManagement() error = %v", err)
+					}
+					managers = append(managers, &Manager{StateMgr: state, WM: fake, Config: config.DefaultConfig()})
+				}
+				return managers
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := wmtest.NewFake()
+			fake.SetAlive("0x01", true)
+			managers := tt.managers(t, fake)
+			track(t, managers[0].StateMgr, "term", "0x01", NotVisible)
+
+			const toggles = 20
+			errs := make(chan error, len(managers)*toggles)
+			var wg sync.WaitGroup
+			for _, m := range managers {
+				wg.Add(1)
+				go func(m *Manager) {
+					defer wg.Done()
+					for i := 0; i < toggles; i++ {
+						errs <- m.Go(Command{Mode: "f", Name: "term"})
+					}
+				}(m)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Fatalf("Go() error = %v", err)
+				}
+			}
+
+			// Every toggle saw the state left by the one before it, so the
+			// window was shown and hidden in turn
+			var last string
+			for _, call := range fake.Calls() {
+				if call.Method != "Show" && call.Method != "Hide" {
+					continue
+				}
+				if call.Method == last {
+					t.Fatalf("%s twice in a row, toggles interleaved", call.Method)
+				}
+				last = call.Method
+			}
+			if got := len(fake.CallsTo("Show")) + len(fake.CallsTo("Hide")); got != len(managers)*toggles {
+				t.Errorf("Show and Hide calls = %d, want %d", got, len(managers)*toggles)
+			}
+			if got := managers[0].StateMgr.GetState("0x01"); got != NotVisible || !fake.IsHidden("0x01") {
+				t.Errorf("GetState() = %v, hidden = %v after an even number of toggles", got, fake.IsHidden("0x01"))
+			}
+		})
+	}
+}
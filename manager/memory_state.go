@@ -0,0 +1,115 @@
+package manager
+
+import (
+	"sync"
+)
+
+// MemoryStateManagement implements StateManagement in process memory. It is
+// not persisted between invocations and is mainly useful for tests.
+type MemoryStateManagement struct {
+	windowRecords
+	// op is held by Lock for a whole operation, mu by every method call
+	op      sync.Mutex
+	mu      sync.Mutex
+	windows map[string]WindowRecord
+	prev    string
+	focus   []FocusEntry
+}
+
+// NewMemoryStateManagement creates a new empty in-memory state management
+func NewMemoryStateManagement() *MemoryStateManagement {
+	s := &MemoryStateManagement{
+		windows: make(map[string]WindowRecord),
+	}
+	s.windowRecords = windowRecords{s}
+	return s
+}
+
+func (s *MemoryStateManagement) Lock() (func(), error) {
+	s.op.Lock()
+	return s.op.Unlock, nil
+}
+
+func (s *MemoryStateManagement) Window(name string) (WindowRecord, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.windows[name]
+	return cloneRecord(record), ok
+}
+
+func (s *MemoryStateManagement) Windows() []WindowRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records := make([]WindowRecord, 0, len(s.windows))
+	for _, record := range s.windows {
+		records = append(records, cloneRecord(record))
+	}
+	return sortRecords(records)
+}
+
+func (s *MemoryStateManagement) UpdateWindow(name string, update func(record *WindowRecord) bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.windows[name]
+	if !ok {
+		record = WindowRecord{Name: name}
+	}
+	record = cloneRecord(record)
+	if update(&record) {
+		s.windows[name] = record
+	}
+	return nil
+}
+
+func (s *MemoryStateManagement) DestroyID(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.windows, name)
+	return nil
+}
+
+func (s *MemoryStateManagement) StorePrevID(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prev = id
+	return nil
+}
+
+func (s *MemoryStateManagement) LoadPrevID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.prev
+}
+
+func (s *MemoryStateManagement) FocusStack() []FocusEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]FocusEntry(nil), s.focus...)
+}
+
+func (s *MemoryStateManagement) SetFocusStack(stack []FocusEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.focus = append([]FocusEntry(nil), stack...)
+	return nil
+}
+
+func (s *MemoryStateManagement) ResetAll() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.windows = make(map[string]WindowRecord)
+	s.prev = ""
+	s.focus = nil
+	return nil
+}
+
+// cloneRecord copies the slices and pointers of record so callers can't
+// change the stored one
+func cloneRecord(record WindowRecord) WindowRecord {
+	record.Groups = append([]string(nil), record.Groups...)
+	if record.Geometry != nil {
+		geometry := *record.Geometry
+		record.Geometry = &geometry
+	}
+	return record
+}
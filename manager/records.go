@@ -0,0 +1,204 @@
+package manager
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// stateSchemaVersion is the layout of the persisted state. Version 1 kept
+// parallel tracked, state, latest and groups hashes; version 2 stores one
+// WindowRecord per tracked name.
+const stateSchemaVersion = 2
+
+// recordStore is what a backend persists the window records with. The rest
+// of StateManagement is derived from it by windowRecords.
+type recordStore interface {
+	Window(name string) (WindowRecord, bool)
+	Windows() []WindowRecord
+	UpdateWindow(name string, update func(record *WindowRecord) bool) error
+}
+
+// windowRecords implements the record based parts of StateManagement on top
+// of a backend's recordStore
+type windowRecords struct {
+	store recordStore
+}
+
+func (r windowRecords) GetID(name string) string {
+	record, _ := r.store.Window(name)
+	return record.ID
+}
+
+func (r windowRecords) StoreID(name, id string) error {
+	return r.store.UpdateWindow(name, func(record *WindowRecord) bool {
+		record.ID = id
+		if record.TrackedAt.IsZero() {
+			record.TrackedAt = time.Now()
+		}
+		return true
+	})
+}
+
+func (r windowRecords) SetState(name string, state WindowState) error {
+	log.Println("setting state: ", name, strconv.Itoa(int(state)))
+	return r.store.UpdateWindow(name, func(record *WindowRecord) bool {
+		if record.ID == "" {
+			return false
+		}
+		record.State = state
+		switch state {
+		case Visible:
+			record.ShownAt = time.Now()
+		case NotVisible:
+			record.HiddenAt = time.Now()
+		}
+		return true
+	})
+}
+
+func (r windowRecords) LatestShown(name string) (string, error) {
+	if name != "" {
+		return "", r.store.UpdateWindow(name, func(record *WindowRecord) bool {
+			record.LatestAt = time.Now()
+			return true
+		})
+	}
+	names := r.AllLatest()
+	if len(names) == 0 {
+		return "", nil
+	}
+	return names[0], nil
+}
+
+// AllLatest orders ties the same way as a Redis ZREVRANGE did before the
+// records replaced the latest sorted set
+func (r windowRecords) AllLatest() []string {
+	var latest []WindowRecord
+	for _, record := range r.store.Windows() {
+		if !record.LatestAt.IsZero() {
+			latest = append(latest, record)
+		}
+	}
+	sort.Slice(latest, func(i, j int) bool {
+		if !latest[i].LatestAt.Equal(latest[j].LatestAt) {
+			return latest[i].LatestAt.After(latest[j].LatestAt)
+		}
+		return latest[i].Name > latest[j].Name
+	})
+	names := make([]string, len(latest))
+	for i, record := range latest {
+		names[i] = record.Name
+	}
+	return names
+}
+
+func (r windowRecords) LatestCount() int {
+	return len(r.AllLatest())
+}
+
+func (r windowRecords) IsLatestEmpty() bool {
+	return r.LatestCount() == 0
+}
+
+func (r windowRecords) RemoveFromLatest(name string) error {
+	return r.store.UpdateWindow(name, func(record *WindowRecord) bool {
+		if record.LatestAt.IsZero() {
+			return false
+		}
+		record.LatestAt = time.Time{}
+		return true
+	})
+}
+
+func (r windowRecords) GetState(id string) WindowState {
+	if id == "" {
+		return Errored
+	}
+	for _, record := range r.store.Windows() {
+		if record.ID == id {
+			return record.State
+		}
+	}
+	return Errored
+}
+
+func (r windowRecords) IsTracked(name string) bool {
+	return r.GetID(name) != ""
+}
+
+func (r windowRecords) AllHidden() []WindowRecord {
+	var hidden []WindowRecord
+	for _, record := range r.store.Windows() {
+		if record.ID != "" && record.State == NotVisible {
+			hidden = append(hidden, record)
+		}
+	}
+	return hidden
+}
+
+func (r windowRecords) AllTracked() map[string]string {
+	all := make(map[string]string)
+	for _, record := range r.store.Windows() {
+		if record.ID != "" {
+			all[record.Name] = record.ID
+		}
+	}
+	return all
+}
+
+func (r windowRecords) Groups(name string) []string {
+	record, _ := r.store.Window(name)
+	return record.Groups
+}
+
+func (r windowRecords) AddToGroups(name string, groups ...string) error {
+	return r.store.UpdateWindow(name, func(record *WindowRecord) bool {
+		record.Groups = mergeGroups(record.Groups, groups)
+		return true
+	})
+}
+
+// sortRecords orders records by name
+func sortRecords(records []WindowRecord) []WindowRecord {
+	sort.Slice(records, func(i, j int) bool { return records[i].Name < records[j].Name })
+	return records
+}
+
+// migrateRecords builds the window records from the parallel hashes of
+// schema version 1. The name "prev" held the previously focused window and
+// is returned separately. Latest scores are counted in latestUnit since the
+// epoch: Redis stored seconds, the state file nanoseconds.
+func migrateRecords(tracked, state map[string]string, latest map[string]float64, groups map[string][]string, latestUnit time.Duration) (map[string]WindowRecord, string) {
+	records := make(map[string]WindowRecord)
+	var prev string
+	for name, id := range tracked {
+		if name == "prev" {
+			prev = id
+			continue
+		}
+		stateInt, _ := strconv.Atoi(state[id])
+		record := WindowRecord{
+			Name:   name,
+			ID:     id,
+			State:  WindowState(stateInt),
+			Groups: groups[name],
+		}
+		if score, ok := latest[name]; ok {
+			record.LatestAt = scoreTime(score, latestUnit)
+		}
+		records[name] = record
+	}
+	for name, score := range latest {
+		if _, ok := records[name]; !ok && name != "prev" {
+			records[name] = WindowRecord{Name: name, LatestAt: scoreTime(score, latestUnit)}
+		}
+	}
+	return records, prev
+}
+
+// scoreTime converts a version 1 latest score counted in unit to a time
+func scoreTime(score float64, unit time.Duration) time.Time {
+	return time.Unix(0, int64(score*float64(unit)))
+}
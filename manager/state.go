@@ -2,149 +2,426 @@ package manager
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"log"
-	"strconv"
+	"os"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/hellola/startorswitch/config"
 	"github.com/redis/go-redis/v9"
 )
 
+const (
+	// redisLockTTL bounds how long a process that died holding the lock
+	// blocks the others. A live holder renews the lock every third of it.
+	redisLockTTL = 10 * time.Second
+	// redisLockWait is how long Lock waits for another process. It covers
+	// the slowest command, launching an application and waiting up to 10s
+	// for its window, with room to spare.
+	redisLockWait  = 30 * time.Second
+	redisLockRetry = 20 * time.Millisecond
+	// redisUpdateRetries bounds how often UpdateWindow retries after
+	// another client changed the windows hash underneath it
+	redisUpdateRetries = 10
+)
+
+// redisUnlock releases the lock only while it still holds the token, leaving
+// it alone if it expired and was taken by another process. Redis executes a
+// script without interleaving other commands.
+var redisUnlock = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// redisRenew extends the lock while it still holds the token: KEYS lock;
+// ARGV token, TTL in milliseconds
+var redisRenew = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
 // RedisStateManagement implements StateManagement using Redis
 type RedisStateManagement struct {
+	windowRecords
 	client *redis.Client
 	ctx    context.Context
+	prefix string
+	// legacyPrefix namespaced the keys before they were kept per session
+	legacyPrefix string
+	// lockTTL is redisLockTTL, shortened by tests
+	lockTTL time.Duration
 }
 
 // NewRedisStateManagement creates a new Redis state management instance
-func NewRedisStateManagement(addr string) (*RedisStateManagement, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr: addr,
-	})
+// connected as configured in cfg. Keys are namespaced by the key prefix
+// followed by the session; state written before that is taken over by the
+// first session to start.
+func NewRedisStateManagement(cfg *config.Config) (*RedisStateManagement, error) {
+	opts, err := redisOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(opts)
 
 	ctx := context.Background()
 	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
 		return nil, err
 	}
 
-	return &RedisStateManagement{
-		client: client,
-		ctx:    ctx,
-	}, nil
+	prefix := cfg.RedisKeyPrefix
+	if session := cfg.SessionKey(); session != "" {
+		prefix += session + ":"
+	}
+	s := &RedisStateManagement{
+		client:       client,
+		ctx:          ctx,
+		prefix:       prefix,
+		legacyPrefix: cfg.RedisKeyPrefix,
+		lockTTL:      redisLockTTL,
+	}
+	s.windowRecords = windowRecords{s}
+	if err := s.migrate(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("migrating redis state: %v", err)
+	}
+	return s, nil
 }
 
-func (s *RedisStateManagement) GetID(name string) string {
-	id, _ := s.client.HGet(s.ctx, "tracked", name).Result()
-	return id
-}
+// migrate converts the tracked, state, latest and groups hashes of schema
+// version 1 into window records. They are read from the session's keys or,
+// if it has none, from the keys written before state was namespaced by
+// session, and replaced in one transaction.
+func (s *RedisStateManagement) migrate() error {
+	version, err := s.client.Get(s.ctx, s.key("schema_version")).Int()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	if version >= stateSchemaVersion {
+		return nil
+	}
+	unlock, err := s.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
-func (s *RedisStateManagement) StoreID(name, id string) error {
-	return s.client.HSet(s.ctx, "tracked", name, id).Err()
-}
+	// Another process may have migrated while we waited for the lock
+	version, err = s.client.Get(s.ctx, s.key("schema_version")).Int()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	if version >= stateSchemaVersion {
+		return nil
+	}
+	source := s.prefix
+	if s.legacyPrefix != s.prefix {
+		found, err := s.client.Exists(s.ctx, s.key("tracked"), s.key("latest")).Result()
+		if err != nil {
+			return err
+		}
+		if found == 0 {
+			source = s.legacyPrefix
+		}
+	}
+	keys := []string{source + "tracked", source + "state", source + "latest", source + "groups"}
 
-func (s *RedisStateManagement) DestroyID(name string) error {
-	id := s.GetID(name)
-	if err := s.client.HDel(s.ctx, "tracked", name).Err(); err != nil {
+	// Sessions started together may all find the legacy keys, the watch
+	// lets only one of them take them over
+	txf := func(tx *redis.Tx) error {
+		tracked, err := tx.HGetAll(s.ctx, keys[0]).Result()
+		if err != nil {
+			return err
+		}
+		state, err := tx.HGetAll(s.ctx, keys[1]).Result()
+		if err != nil {
+			return err
+		}
+		scores, err := tx.ZRangeWithScores(s.ctx, keys[2], 0, -1).Result()
+		if err != nil {
+			return err
+		}
+		latest := make(map[string]float64, len(scores))
+		for _, z := range scores {
+			latest[fmt.Sprint(z.Member)] = z.Score
+		}
+		rawGroups, err := tx.HGetAll(s.ctx, keys[3]).Result()
+		if err != nil {
+			return err
+		}
+		groups := make(map[string][]string, len(rawGroups))
+		for name, list := range rawGroups {
+			groups[name] = splitGroups(list)
+		}
+
+		records, prev := migrateRecords(tracked, state, latest, groups, time.Second)
+		if len(records) > 0 || prev != "" {
+			log.Printf("Migrating %d tracked windows from %q to redis schema version %d", len(records), source, stateSchemaVersion)
+		}
+		_, err = tx.TxPipelined(s.ctx, func(pipe redis.Pipeliner) error {
+			for name, record := range records {
+				raw, err := json.Marshal(record)
+				if err != nil {
+					return err
+				}
+				pipe.HSet(s.ctx, s.key("windows"), name, raw)
+			}
+			if prev != "" {
+				pipe.Set(s.ctx, s.key("prev"), prev, 0)
+			}
+			pipe.Del(s.ctx, keys...)
+			pipe.Set(s.ctx, s.key("schema_version"), stateSchemaVersion, 0)
+			return nil
+		})
 		return err
 	}
-	return s.client.HDel(s.ctx, "state", id).Err()
+	for i := 0; i < redisUpdateRetries; i++ {
+		err := s.client.Watch(s.ctx, txf, keys...)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return fmt.Errorf("migrating %q: %w", source, redis.TxFailedErr)
 }
 
-func (s *RedisStateManagement) SetState(name string, state WindowState) error {
-	id := s.GetID(name)
-	log.Println("setting state: ", id, strconv.Itoa(int(state)))
-	return s.client.HSet(s.ctx, "state", id, strconv.Itoa(int(state))).Err()
+// redisOptions translates the Redis settings of cfg into client options
+func redisOptions(cfg *config.Config) (*redis.Options, error) {
+	opts := &redis.Options{
+		Addr:     cfg.RedisAddr,
+		Username: cfg.RedisUsername,
+		Password: cfg.RedisPassword,
+		DB:       cfg.RedisDB,
+	}
+	if cfg.RedisSocket != "" {
+		opts.Network = "unix"
+		opts.Addr = cfg.RedisSocket
+	}
+	if cfg.RedisTLS != nil {
+		tlsConfig, err := redisTLSConfig(cfg.RedisTLS)
+		if err != nil {
+			return nil, err
+		}
+		opts.TLSConfig = tlsConfig
+	}
+	return opts, nil
 }
 
-func (s *RedisStateManagement) LatestShown(name string) (string, error) {
-	if name != "" {
-		err := s.client.ZAdd(s.ctx, "latest", redis.Z{
-			Score:  float64(time.Now().Unix()),
-			Member: name,
-		}).Err()
-		return "", err
+// redisTLSConfig loads the CA and client certificate named in settings
+func redisTLSConfig(settings *config.RedisTLS) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         settings.ServerName,
+		InsecureSkipVerify: settings.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
 	}
-	result, err := s.client.ZRevRange(s.ctx, "latest", 0, 0).Result()
-	if err != nil {
-		return "", err
+	if settings.CAFile != "" {
+		pem, err := os.ReadFile(settings.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading redis CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in redis CA file %s", settings.CAFile)
+		}
+		tlsConfig.RootCAs = pool
 	}
-	if len(result) == 0 {
-		return "", nil
+	if settings.CertFile != "" || settings.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(settings.CertFile, settings.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading redis client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
 	}
-	return result[0], nil
+	return tlsConfig, nil
 }
 
-func (s *RedisStateManagement) LatestCount() int {
-	count, _ := s.client.ZCount(s.ctx, "latest", "-inf", "+inf").Result()
-	return int(count)
+// key returns the namespaced name of one of the backend's keys
+func (s *RedisStateManagement) key(name string) string {
+	return s.prefix + name
 }
 
-func (s *RedisStateManagement) IsLatestEmpty() bool {
-	return s.LatestCount() == 0
-}
+// Lock takes the lock key with SET NX, retrying until redisLockWait has
+// passed. The key expires after redisLockTTL in case the process dies, so
+// it is renewed in the background until unlock is called.
+func (s *RedisStateManagement) Lock() (func(), error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	token := hex.EncodeToString(raw)
+	deadline := time.Now().Add(redisLockWait)
+	for {
+		ok, err := s.client.SetNX(s.ctx, s.key("lock"), token, s.lockTTL).Result()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("state locked by another process for over %s", redisLockWait)
+		}
+		time.Sleep(redisLockRetry)
+	}
 
-func (s *RedisStateManagement) RemoveFromLatest(name string) error {
-	return s.client.ZRem(s.ctx, "latest", name).Err()
+	done := make(chan struct{})
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		ticker := time.NewTicker(s.lockTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				held, err := redisRenew.Run(s.ctx, s.client, []string{s.key("lock")}, token, s.lockTTL.Milliseconds()).Int()
+				if err != nil {
+					log.Printf("Error renewing redis lock: %v", err)
+				} else if held == 0 {
+					log.Printf("Redis lock expired before it could be renewed")
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-renewed
+		if err := redisUnlock.Run(s.ctx, s.client, []string{s.key("lock")}, token).Err(); err != nil {
+			log.Printf("Error releasing redis lock: %v", err)
+		}
+	}, nil
 }
 
-func (s *RedisStateManagement) GetState(id string) WindowState {
-	state, _ := s.client.HGet(s.ctx, "state", id).Result()
-	stateInt, _ := strconv.Atoi(state)
-	return WindowState(stateInt)
+func (s *RedisStateManagement) Window(name string) (WindowRecord, bool) {
+	raw, err := s.client.HGet(s.ctx, s.key("windows"), name).Result()
+	if err != nil {
+		return WindowRecord{}, false
+	}
+	return decodeRecord(name, raw)
 }
 
-func (s *RedisStateManagement) IsTracked(name string) bool {
-	id := s.GetID(name)
-	return id != ""
+func (s *RedisStateManagement) Windows() []WindowRecord {
+	all, _ := s.client.HGetAll(s.ctx, s.key("windows")).Result()
+	records := make([]WindowRecord, 0, len(all))
+	for name, raw := range all {
+		if record, ok := decodeRecord(name, raw); ok {
+			records = append(records, record)
+		}
+	}
+	return sortRecords(records)
 }
 
-func (s *RedisStateManagement) SaveCurrent(name string, windowType WindowType, focusedID string) error {
-	var current string
-	if windowType == TypeFocused {
-		current = focusedID
-	} else if windowType == TypeApplication {
-		current = focusedID // This will be replaced by the actual window ID after starting the application
+// UpdateWindow watches the windows hash and retries the update if another
+// client changed it before the write
+func (s *RedisStateManagement) UpdateWindow(name string, update func(record *WindowRecord) bool) error {
+	key := s.key("windows")
+	txf := func(tx *redis.Tx) error {
+		raw, err := tx.HGet(s.ctx, key, name).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		record := WindowRecord{Name: name}
+		if err == nil {
+			record, _ = decodeRecord(name, raw)
+		}
+		if !update(&record) {
+			return nil
+		}
+		encoded, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(s.ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(s.ctx, key, name, encoded)
+			return nil
+		})
+		return err
+	}
+	for i := 0; i < redisUpdateRetries; i++ {
+		err := s.client.Watch(s.ctx, txf, key)
+		if err != redis.TxFailedErr {
+			return err
+		}
 	}
-	return s.StoreID(name, current)
+	return fmt.Errorf("updating %s: %w", name, redis.TxFailedErr)
+}
+
+func (s *RedisStateManagement) DestroyID(name string) error {
+	return s.client.HDel(s.ctx, s.key("windows"), name).Err()
 }
 
 func (s *RedisStateManagement) StorePrevID(id string) error {
-	return s.client.HSet(s.ctx, "tracked", "prev", id).Err()
+	return s.client.Set(s.ctx, s.key("prev"), id, 0).Err()
 }
 
 func (s *RedisStateManagement) LoadPrevID() string {
-	id, _ := s.client.HGet(s.ctx, "tracked", "prev").Result()
+	id, _ := s.client.Get(s.ctx, s.key("prev")).Result()
 	return id
 }
 
-func (s *RedisStateManagement) AllHidden() []struct {
-	Name string
-	ID   string
-} {
-	var hidden []struct {
-		Name string
-		ID   string
+func (s *RedisStateManagement) FocusStack() []FocusEntry {
+	raw, _ := s.client.Get(s.ctx, s.key("focus_stack")).Result()
+	var stack []FocusEntry
+	if raw != "" {
+		json.Unmarshal([]byte(raw), &stack)
 	}
+	return stack
+}
 
-	all := s.AllTracked()
-	for name, id := range all {
-		if s.GetState(id) == NotVisible {
-			hidden = append(hidden, struct {
-				Name string
-				ID   string
-			}{name, id})
-		}
+func (s *RedisStateManagement) SetFocusStack(stack []FocusEntry) error {
+	raw, err := json.Marshal(stack)
+	if err != nil {
+		return err
 	}
-	return hidden
+	return s.client.Set(s.ctx, s.key("focus_stack"), raw, 0).Err()
 }
 
+// ResetAll deletes the keys in a single, atomic DEL. The lock and schema
+// version keys stay, the lock is held by the caller.
 func (s *RedisStateManagement) ResetAll() error {
-	if err := s.client.Del(s.ctx, "tracked").Err(); err != nil {
-		return err
+	return s.client.Del(s.ctx, s.key("windows"), s.key("prev"), s.key("focus_stack")).Err()
+}
+
+// decodeRecord parses a record stored in the windows hash under name
+func decodeRecord(name, raw string) (WindowRecord, bool) {
+	var record WindowRecord
+	if err := json.Unmarshal([]byte(raw), &record); err != nil {
+		log.Printf("error unmarshalling window record %s: %v", name, err)
+		return WindowRecord{Name: name}, false
 	}
-	return s.client.Del(s.ctx, "state").Err()
+	record.Name = name
+	return record, true
 }
 
-func (s *RedisStateManagement) AllTracked() map[string]string {
-	all, _ := s.client.HGetAll(s.ctx, "tracked").Result()
-	return all
+// splitGroups parses the comma separated group list stored by the Redis
+// backend
+func splitGroups(groups string) []string {
+	if groups == "" {
+		return nil
+	}
+	return strings.Split(groups, ",")
+}
+
+// mergeGroups returns the sorted union of two group lists
+func mergeGroups(current, added []string) []string {
+	seen := make(map[string]bool)
+	var merged []string
+	for _, group := range append(append([]string(nil), current...), added...) {
+		if group != "" && !seen[group] {
+			seen[group] = true
+			merged = append(merged, group)
+		}
+	}
+	sort.Strings(merged)
+	return merged
 }
@@ -1,20 +1,45 @@
 package manager
 
 import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/hellola/startorswitch/config"
+	"github.com/redis/go-redis/v9"
 )
 
-func TestRedisStateManagement_GetID(t *testing.T) {
+// newTestRedis connects to the Redis instance on localhost, skipping the test
+// when none is running. Keys are prefixed to stay clear of real state. The
+// memory and file backends cover the same behaviour hermetically.
+func newTestRedis(t *testing.T) *RedisStateManagement {
+	t.Helper()
+	return newTestRedisPrefix(t, "startorswitch-test:")
+}
 
-	redis, err := NewRedisStateManagement("localhost:6379")
+// newTestRedisPrefix is newTestRedis with its own connection and key prefix,
+// standing in for another process or user sharing the server
+func newTestRedisPrefix(t *testing.T, prefix string) *RedisStateManagement {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.RedisKeyPrefix = prefix
+	redis, err := NewRedisStateManagement(cfg)
 	if err != nil {
-		t.Fatalf("Failed to create Redis state management: %v", err)
+		t.Skipf("Redis not available: %v", err)
 	}
+	return redis
+}
+
+func TestRedisStateManagement_GetID(t *testing.T) {
+
+	redis := newTestRedis(t)
 
 	name := "testing-1"
 	expectedId := "12345"
 
-	err = redis.StoreID(name, expectedId)
+	err := redis.StoreID(name, expectedId)
 	if err != nil {
 		t.Errorf("GetID failed: %v", err)
 	}
@@ -27,10 +52,7 @@ func TestRedisStateManagement_GetID(t *testing.T) {
 
 func TestRedisStateManagement_GetState(t *testing.T) {
 	// Initialize Redis client with test instance
-	redis, err := NewRedisStateManagement("localhost:6379")
-	if err != nil {
-		t.Fatalf("Failed to create Redis state management: %v", err)
-	}
+	redis := newTestRedis(t)
 
 	// Test cases
 	tests := []struct {
@@ -78,3 +100,209 @@ func TestRedisStateManagement_GetState(t *testing.T) {
 	// 	t.Errorf("Failed to clean up test data: %v", err)
 	// }
 }
+
+func TestRedisOptions(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.RedisUsername = "sos"
+	cfg.RedisPassword = "secret"
+	cfg.RedisDB = 3
+	cfg.RedisSocket = "/run/redis/redis.sock"
+	cfg.RedisTLS = &config.RedisTLS{ServerName: "redis.internal"}
+
+	opts, err := redisOptions(cfg)
+	if err != nil {
+		t.Fatalf("redisOptions() error = %v", err)
+	}
+	if opts.Network != "unix" || opts.Addr != "/run/redis/redis.sock" {
+		t.Errorf("Network, Addr = %s, %s, want unix, /run/redis/redis.sock", opts.Network, opts.Addr)
+	}
+	if opts.Username != "sos" || opts.Password != "secret" || opts.DB != 3 {
+		t.Errorf("Username, Password, DB = %s, %s, %d, want sos, secret, 3", opts.Username, opts.Password, opts.DB)
+	}
+	if opts.TLSConfig == nil || opts.TLSConfig.ServerName != "redis.internal" || opts.TLSConfig.MinVersion != tls.VersionTLS12 {
+		t.Errorf("TLSConfig = %+v, want server name redis.internal", opts.TLSConfig)
+	}
+
+	cfg.RedisTLS = &config.RedisTLS{CAFile: filepath.Join(t.TempDir(), "missing.pem")}
+	if _, err := redisOptions(cfg); err == nil {
+		t.Errorf("redisOptions() with a missing CA file error = nil")
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	if err := os.WriteFile(empty, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg.RedisTLS = &config.RedisTLS{CAFile: empty}
+	if _, err := redisOptions(cfg); err == nil {
+		t.Errorf("redisOptions() with an empty CA file error = nil")
+	}
+}
+
+func TestRedisStateManagement_KeyPrefix(t *testing.T) {
+	redis := newTestRedis(t)
+	other := newTestRedisPrefix(t, "startorswitch-test-other:")
+	t.Cleanup(func() {
+		redis.ResetAll()
+		other.ResetAll()
+	})
+
+	if err := other.StoreID("term", "0x01"); err != nil {
+		t.Fatalf("StoreID failed: %v", err)
+	}
+	if err := redis.StoreID("term", "0x02"); err != nil {
+		t.Fatalf("StoreID failed: %v", err)
+	}
+	if err := redis.ResetAll(); err != nil {
+		t.Fatalf("ResetAll failed: %v", err)
+	}
+	if id := other.GetID("term"); id != "0x01" {
+		t.Errorf("GetID() under another prefix = %s after ResetAll, want 0x01", id)
+	}
+}
+
+func TestRedisStateManagement_Lock(t *testing.T) {
+	redis := newTestRedis(t)
+	other := newTestRedis(t)
+
+	unlock, err := redis.Lock()
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	acquired := make(chan struct{})
+	go func() {
+		unlockOther, err := other.Lock()
+		if err != nil {
+			t.Errorf("second Lock() error = %v", err)
+		} else {
+			unlockOther()
+		}
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatalf("second Lock() returned while the lock was held")
+	case <-time.After(100 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatalf("second Lock() still waiting after unlock")
+	}
+}
+
+func TestRedisStateManagement_AdoptsLegacyKeys(t *testing.T) {
+	legacy := newTestRedis(t)
+	legacy.prefix = "startorswitch-test:"
+	t.Cleanup(func() { legacy.client.Del(legacy.ctx, legacy.key("tracked"), legacy.key("state")) })
+	legacy.client.Del(legacy.ctx, legacy.key("tracked"), legacy.key("state"))
+	// Keys as written before state was namespaced by session
+	if err := legacy.client.HSet(legacy.ctx, legacy.key("tracked"), "term", "0x01").Err(); err != nil {
+		t.Fatalf("HSet failed: %v", err)
+	}
+	if err := legacy.client.HSet(legacy.ctx, legacy.key("state"), "0x01", "2").Err(); err != nil {
+		t.Fatalf("HSet failed: %v", err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.RedisKeyPrefix = "startorswitch-test:"
+	cfg.Session = "legacy-test"
+	session, err := NewRedisStateManagement(cfg)
+	if err != nil {
+		t.Fatalf("NewRedisStateManagement() error = %v", err)
+	}
+	t.Cleanup(func() {
+		session.ResetAll()
+		session.client.Del(session.ctx, session.key("schema_version"))
+	})
+
+	if id := session.GetID("term"); id != "0x01" {
+		t.Errorf("GetID() = %s, want 0x01 taken over from the legacy keys", id)
+	}
+	if got := session.GetState("0x01"); got != NotVisible {
+		t.Errorf("GetState() = %v, want %v", got, NotVisible)
+	}
+	if n, _ := legacy.client.Exists(legacy.ctx, legacy.key("tracked")).Result(); n != 0 {
+		t.Errorf("legacy tracked hash still present")
+	}
+}
+
+func TestRedisStateManagement_LockRenewed(t *testing.T) {
+	redis := newTestRedis(t)
+	redis.lockTTL = 150 * time.Millisecond
+	other := newTestRedis(t)
+	other.lockTTL = redis.lockTTL
+
+	unlock, err := redis.Lock()
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	acquired := make(chan struct{})
+	go func() {
+		unlockOther, err := other.Lock()
+		if err != nil {
+			t.Errorf("second Lock() error = %v", err)
+		} else {
+			unlockOther()
+		}
+		close(acquired)
+	}()
+
+	// The holder runs well past the TTL, as when launching an application
+	select {
+	case <-acquired:
+		t.Fatalf("second Lock() returned after the TTL while the lock was held")
+	case <-time.After(4 * redis.lockTTL):
+	}
+	unlock()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatalf("second Lock() still waiting after unlock")
+	}
+}
+
+func TestMigrateRecords_RedisScores(t *testing.T) {
+	// The Redis backend scored the latest sorted set in Unix seconds
+	tracked := map[string]string{"term": "0x01", "prev": "0x09"}
+	state := map[string]string{"0x01": "1"}
+	latest := map[string]float64{"term": 1700000000, "notes": 1700000060}
+
+	records, prev := migrateRecords(tracked, state, latest, nil, time.Second)
+	if prev != "0x09" {
+		t.Errorf("prev = %s, want 0x09", prev)
+	}
+	if got, want := records["term"].LatestAt, time.Unix(1700000000, 0); !got.Equal(want) {
+		t.Errorf("term LatestAt = %v, want %v", got, want)
+	}
+	if got, want := records["notes"].LatestAt, time.Unix(1700000060, 0); !got.Equal(want) {
+		t.Errorf("notes LatestAt = %v, want %v", got, want)
+	}
+	if records["term"].State != Visible {
+		t.Errorf("term State = %v, want %v", records["term"].State, Visible)
+	}
+}
+
+func TestRedisStateManagement_MigratesLatestSeconds(t *testing.T) {
+	old := newTestRedis(t)
+	old.client.Del(old.ctx, old.key("windows"), old.key("schema_version"))
+	t.Cleanup(func() { old.client.Del(old.ctx, old.key("tracked"), old.key("latest")) })
+	// Keys as written by schema version 1
+	if err := old.client.HSet(old.ctx, old.key("tracked"), "term", "0x01").Err(); err != nil {
+		t.Fatalf("HSet failed: %v", err)
+	}
+	if err := old.client.ZAdd(old.ctx, old.key("latest"), redis.Z{Score: 1700000000, Member: "term"}).Err(); err != nil {
+		t.Fatalf("ZAdd failed: %v", err)
+	}
+
+	migrated := newTestRedis(t)
+	t.Cleanup(func() { migrated.ResetAll() })
+	record, ok := migrated.Window("term")
+	if !ok {
+		t.Fatalf("Window(term) not migrated")
+	}
+	if want := time.Unix(1700000000, 0); !record.LatestAt.Equal(want) {
+		t.Errorf("LatestAt = %v, want %v", record.LatestAt, want)
+	}
+}
@@ -0,0 +1,73 @@
+package manager
+
+import (
+	"log"
+
+	"github.com/hellola/startorswitch/wm"
+)
+
+// WindowStatus describes a tracked window as seen by the state backend and
+// the window manager
+type WindowStatus struct {
+	Name  string `json:"name"`
+	ID    string `json:"id"`
+	State string `json:"state"`
+	// Latest is the position in the most recently shown list, starting at
+	// 1, or 0 if the window is not in it
+	Latest    int    `json:"latest"`
+	Alive     bool   `json:"alive"`
+	Focused   bool   `json:"focused"`
+	Workspace string `json:"workspace"`
+	Class     string `json:"class"`
+	Title     string `json:"title"`
+}
+
+// Status returns every tracked window ordered by name. Window details are
+// only filled in when the backend can list its windows, otherwise the
+// workspace is the one recorded when the window was tracked.
+func (m *Manager) Status() ([]WindowStatus, error) {
+	latest := make(map[string]int)
+	for i, name := range m.StateMgr.AllLatest() {
+		latest[name] = i + 1
+	}
+
+	var windows map[string]wm.Window
+	if lister, ok := m.WM.(wm.WindowLister); ok {
+		list, err := lister.Windows()
+		if err != nil {
+			return nil, err
+		}
+		windows = make(map[string]wm.Window, len(list))
+		for _, window := range list {
+			windows[window.ID] = window
+		}
+	}
+	focused := m.WM.GetFocusedID()
+
+	status := make([]WindowStatus, 0)
+	for _, record := range m.StateMgr.Windows() {
+		if record.ID == "" {
+			continue
+		}
+		s := WindowStatus{
+			Name:      record.Name,
+			ID:        record.ID,
+			State:     record.State.String(),
+			Latest:    latest[record.Name],
+			Focused:   record.ID == focused,
+			Workspace: record.Workspace,
+		}
+		if windows != nil {
+			window, ok := windows[record.ID]
+			s.Alive = ok
+			s.Workspace = window.Workspace
+			s.Class = window.Class
+			s.Title = window.Title
+		} else {
+			s.Alive = m.WM.StillAlive(record.ID)
+		}
+		status = append(status, s)
+	}
+	log.Printf("Status of %d tracked windows", len(status))
+	return status, nil
+}
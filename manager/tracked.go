@@ -2,8 +2,12 @@ package manager
 
 import (
 	"errors"
+	"fmt"
 	"log"
+	"strings"
+	"time"
 
+	"github.com/hellola/startorswitch/config"
 	"github.com/hellola/startorswitch/wm"
 )
 
@@ -12,6 +16,15 @@ type Tracked struct {
 	Name     string
 	Type     WindowType
 	SwitchTo bool
+	App      config.App
+	// GroupsOf returns the groups a tracked name belongs to. Exclusive
+	// windows only hide windows sharing a group with them, or every
+	// ungrouped window if they have no group. Nil treats all windows as
+	// one group.
+	GroupsOf func(name string) []string
+	// Other creates the Tracked for another name, configured the way t
+	// was. Nil uses NewTracked without app config or groups.
+	Other    func(name string) *Tracked
 	StateMgr StateManagement
 	WM       wm.WMIntegration
 }
@@ -23,6 +36,7 @@ func NewTracked(name string, windowType WindowType, switchTo bool, stateMgr Stat
 		Name:     name,
 		Type:     windowType,
 		SwitchTo: switchTo,
+		App:      config.DefaultApp(name),
 		StateMgr: stateMgr,
 		WM:       wm,
 	}
@@ -35,16 +49,42 @@ func (t *Tracked) ID() string {
 	return id
 }
 
-// State returns the current window state
+// State returns the current window state. Backends that can tell whether
+// a window is hidden correct the stored state first, e.g. after the window
+// was minimized from the taskbar.
 func (t *Tracked) State() WindowState {
-	state := t.StateMgr.GetState(t.ID())
-	log.Printf("Getting state for window %s: %v", t.Name, state)
+	record, _ := t.StateMgr.Window(t.Name)
+	id, state := record.ID, record.State
+	if id == "" {
+		state = Errored
+	}
+	log.Printf("Getting state for window %s (%s): %v", t.Name, id, state)
+	if reporter, ok := t.WM.(wm.VisibilityReporter); ok && id != "" {
+		if hidden, err := reporter.IsHidden(id); err != nil {
+			log.Printf("Error checking whether window %s is hidden: %v", t.Name, err)
+		} else if actual := visibility(hidden); actual != state {
+			log.Printf("Window %s is %v, correcting the state", t.Name, actual)
+			if err := t.StateMgr.SetState(t.Name, actual); err != nil {
+				log.Printf("Error correcting state of window %s: %v", t.Name, err)
+			}
+			state = actual
+		}
+	}
 	if state == Errored {
 		return Visible
 	}
 	return state
 }
 
+// visibility returns the state of a window the window manager reports as
+// hidden or not
+func visibility(hidden bool) WindowState {
+	if hidden {
+		return NotVisible
+	}
+	return Visible
+}
+
 // SetupTracking initializes tracking for the window
 func (t *Tracked) SetupTracking() error {
 	log.Printf("Setting up tracking for window %s", t.Name)
@@ -61,7 +101,7 @@ func (t *Tracked) SetupTracking() error {
 	if t.Type == TypeApplication {
 		log.Printf("Finding or starting application %s", t.Name)
 		var err error
-		focusedID, err = t.WM.FindOrStartApplication(t.Name)
+		focusedID, err = t.WM.FindOrStartApplication(t.App)
 		if err != nil {
 			log.Printf("Error finding or starting application %s: %v", t.Name, err)
 			return err
@@ -72,7 +112,50 @@ func (t *Tracked) SetupTracking() error {
 	}
 
 	log.Printf("Saving current state for window %s", t.Name)
-	return t.StateMgr.SaveCurrent(t.Name, t.Type, focusedID)
+	workspace := t.workspaceOf(focusedID)
+	return t.StateMgr.UpdateWindow(t.Name, func(record *WindowRecord) bool {
+		record.ID = focusedID
+		record.Type = t.Type
+		record.Workspace = workspace
+		record.TrackedAt = time.Now()
+		if t.Type == TypeApplication {
+			record.Command = strings.Join(append([]string{t.App.Command}, t.App.Args...), " ")
+		}
+		return true
+	})
+}
+
+// rememberWorkspace records the workspace the window is on, for following
+// it back there once it was hidden off it
+func (t *Tracked) rememberWorkspace() error {
+	workspace := t.workspaceOf(t.ID())
+	if workspace == "" {
+		return nil
+	}
+	return t.StateMgr.UpdateWindow(t.Name, func(record *WindowRecord) bool {
+		record.Workspace = workspace
+		return record.ID != ""
+	})
+}
+
+// workspaceOf returns the workspace of the window id, if the window manager
+// can list its windows
+func (t *Tracked) workspaceOf(id string) string {
+	lister, ok := t.WM.(wm.WindowLister)
+	if !ok || id == "" {
+		return ""
+	}
+	windows, err := lister.Windows()
+	if err != nil {
+		log.Printf("Error listing windows: %v", err)
+		return ""
+	}
+	for _, window := range windows {
+		if window.ID == id {
+			return window.Workspace
+		}
+	}
+	return ""
 }
 
 // Destroy removes the window from tracking
@@ -87,6 +170,46 @@ func (t *Tracked) Hide() error {
 	return t.WM.Hide(t.ID())
 }
 
+// Show shows the window without touching the state. It is brought to the
+// focused desktop unless the app follows windows to their own desktop.
+func (t *Tracked) Show() error {
+	log.Printf("Showing window %s", t.Name)
+	show := t.WM.Show
+	if t.App.Follows() {
+		follower, ok := t.WM.(wm.Follower)
+		if !ok {
+			return fmt.Errorf("follow for %s: %w", t.Name, wm.ErrUnsupported)
+		}
+		record, _ := t.StateMgr.Window(t.Name)
+		show = func(id string) error { return follower.Follow(id, record.Workspace) }
+	}
+	if err := show(t.ID()); err != nil {
+		return err
+	}
+	return t.Place()
+}
+
+// Place moves the window to where the app's geometry puts it, if it has
+// one
+func (t *Tracked) Place() error {
+	if t.App.Geometry == nil {
+		return nil
+	}
+	placer, ok := t.WM.(wm.Placer)
+	if !ok {
+		return fmt.Errorf("geometry of %s: %w", t.Name, wm.ErrUnsupported)
+	}
+	log.Printf("Placing window %s at %+v", t.Name, *t.App.Geometry)
+	if err := placer.Place(t.ID(), *t.App.Geometry); err != nil {
+		return err
+	}
+	geometry := *t.App.Geometry
+	return t.StateMgr.UpdateWindow(t.Name, func(record *WindowRecord) bool {
+		record.Geometry = &geometry
+		return record.ID != ""
+	})
+}
+
 // IsTracked checks if the window is being tracked
 func (t *Tracked) IsTracked() bool {
 	isTracked := t.StateMgr.IsTracked(t.Name)
@@ -103,7 +226,7 @@ func (t *Tracked) SetState(state WindowState) error {
 // ShowAndUpdate shows the window and updates the state management
 func (t *Tracked) ShowAndUpdate() error {
 	log.Printf("Showing and updating window %s", t.Name)
-	if err := t.WM.Show(t.ID()); err != nil {
+	if err := t.Show(); err != nil {
 		log.Printf("Error showing window %s: %v", t.Name, err)
 		return err
 	}
@@ -123,6 +246,11 @@ func (t *Tracked) HideAndUpdate() error {
 			return err
 		}
 	}
+	if t.App.Follows() {
+		if err := t.rememberWorkspace(); err != nil {
+			return err
+		}
+	}
 	if err := t.WM.Hide(t.ID()); err != nil {
 		log.Printf("Error hiding window %s: %v", t.Name, err)
 		return err
@@ -164,19 +292,70 @@ func (t *Tracked) ShowOrHide() error {
 			log.Printf("Error hiding window %s: %v", t.Name, err)
 			return err
 		}
-		// log.Printf("Focusing previous window %s", previous)
-		// return t.WM.Focus(previous)
+		return t.RestoreFocus()
 	case NotVisible:
 		log.Printf("Window %s is not visible, showing", t.Name)
-		if err := t.StateMgr.StorePrevID(t.WM.GetFocusedID()); err != nil {
+		if err := t.RememberFocus(t.WM.GetFocusedID()); err != nil {
 			log.Printf("Error storing previous ID for window %s: %v", t.Name, err)
 			return err
 		}
+		if t.App.IsExclusive() {
+			if err := t.HideOthers(); err != nil {
+				return err
+			}
+		}
 		return t.ShowAndUpdate()
 	}
 	return nil
 }
 
+// HideOthers hides every other visible tracked window in the same group,
+// used when showing an exclusive window
+func (t *Tracked) HideOthers() error {
+	log.Printf("Hiding windows other than %s", t.Name)
+	for _, record := range t.StateMgr.Windows() {
+		if record.Name == t.Name || record.ID == "" {
+			continue
+		}
+		if record.State != Visible || !t.sharesGroup(record.Name) {
+			continue
+		}
+		if err := t.other(record.Name).HideAndUpdate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// other returns the Tracked for another name, used to act on the windows
+// around t
+func (t *Tracked) other(name string) *Tracked {
+	if t.Other != nil {
+		return t.Other(name)
+	}
+	return NewTracked(name, TypeFocused, false, t.StateMgr, t.WM)
+}
+
+// sharesGroup reports whether name is in one of t's groups, or ungrouped
+// like t
+func (t *Tracked) sharesGroup(name string) bool {
+	if t.GroupsOf == nil {
+		return true
+	}
+	own, other := t.GroupsOf(t.Name), t.GroupsOf(name)
+	if len(own) == 0 {
+		return len(other) == 0
+	}
+	for _, group := range own {
+		for _, g := range other {
+			if g == group {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // ToggleAndUpdate toggles the window state and updates the state management
 func (t *Tracked) ToggleAndUpdate() error {
 	log.Printf("Toggling and updating window %s", t.Name)
@@ -1,5 +1,11 @@
 package manager
 
+import (
+	"time"
+
+	"github.com/hellola/startorswitch/config"
+)
+
 // WindowState represents the visibility state of a window
 type WindowState int
 
@@ -9,6 +15,18 @@ const (
 	NotVisible
 )
 
+// String returns the name used for the state in status output
+func (s WindowState) String() string {
+	switch s {
+	case Visible:
+		return "visible"
+	case NotVisible:
+		return "hidden"
+	default:
+		return "unknown"
+	}
+}
+
 // WindowType represents the type of window being tracked
 type WindowType int
 
@@ -22,25 +40,78 @@ const (
 	TypeShowAll
 )
 
+// FocusEntry records the window that had focus when the tracked window
+// Name was shown
+type FocusEntry struct {
+	Name string `json:"name"`
+	ID   string `json:"id"`
+}
+
+// WindowRecord is everything kept about a tracked name. Backends persist it
+// as one unit.
+type WindowRecord struct {
+	Name  string      `json:"name"`
+	ID    string      `json:"id"`
+	Type  WindowType  `json:"type"`
+	State WindowState `json:"state"`
+	// Workspace is where the window was when it started being tracked or,
+	// for apps that follow their window, last hidden, if the window
+	// manager reported it
+	Workspace string `json:"workspace,omitempty"`
+	// Geometry is what the window was last placed with
+	Geometry *config.Geometry `json:"geometry,omitempty"`
+	// Command launched the window of an application
+	Command string   `json:"command,omitempty"`
+	Groups  []string `json:"groups,omitempty"`
+	// TrackedAt, ShownAt and HiddenAt are when the name was tracked and
+	// its window last shown and hidden
+	TrackedAt time.Time `json:"tracked_at,omitzero"`
+	ShownAt   time.Time `json:"shown_at,omitzero"`
+	HiddenAt  time.Time `json:"hidden_at,omitzero"`
+	// LatestAt orders the latest set, it is zero when the name is not in it
+	LatestAt time.Time `json:"latest_at,omitzero"`
+}
+
 // StateManagement defines the interface for state persistence
 type StateManagement interface {
+	// Window returns the record of name and whether there is one
+	Window(name string) (WindowRecord, bool)
+	// Windows returns every record ordered by name
+	Windows() []WindowRecord
+	// UpdateWindow atomically passes the record of name, empty apart from
+	// the name if there is none, to update and saves it if update returns
+	// true
+	UpdateWindow(name string, update func(record *WindowRecord) bool) error
 	GetID(name string) string
 	StoreID(name, id string) error
 	DestroyID(name string) error
 	SetState(name string, state WindowState) error
 	LatestShown(name string) (string, error)
+	// AllLatest returns the names in latest from most to least recently
+	// shown
+	AllLatest() []string
 	LatestCount() int
 	IsLatestEmpty() bool
 	RemoveFromLatest(name string) error
+	// GetState looks a window up by ID, reading every record; loops over
+	// the tracked windows use the records from Windows instead
 	GetState(id string) WindowState
 	IsTracked(name string) bool
-	SaveCurrent(name string, windowType WindowType, focusedID string) error
 	StorePrevID(id string) error
 	LoadPrevID() string
-	AllHidden() []struct {
-		Name string
-		ID   string
-	}
+	// Lock blocks until the caller holds the exclusive lock on the state,
+	// shared with other processes using the same state, and returns the
+	// function releasing it. The other methods don't take it themselves.
+	Lock() (unlock func(), err error)
+	// FocusStack returns the windows to return focus to, oldest first
+	FocusStack() []FocusEntry
+	SetFocusStack(stack []FocusEntry) error
+	AllHidden() []WindowRecord
 	ResetAll() error
+	// AllTracked maps the names that have a window to its ID
 	AllTracked() map[string]string
+	// Groups returns the groups name was assigned to
+	Groups(name string) []string
+	// AddToGroups assigns name to groups in addition to its current ones
+	AddToGroups(name string, groups ...string) error
 }
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/hellola/startorswitch/config"
+	"github.com/hellola/startorswitch/manager"
+)
+
+// defaultPickers are tried in order when the config does not name a picker
+var defaultPickers = [][]string{
+	{"rofi", "-dmenu", "-i", "-p", "startorswitch"},
+	{"fuzzel", "--dmenu"},
+	{"wofi", "--dmenu", "-i"},
+	{"dmenu", "-i"},
+}
+
+// pickActions maps the -action values to the command run on the choice
+var pickActions = map[string]func(name string) manager.Command{
+	"toggle": func(name string) manager.Command {
+		return manager.Command{Mode: "focus", Name: name}
+	},
+	"focus": func(name string) manager.Command {
+		return manager.Command{Mode: "show", Name: name, Options: map[string]string{"focus": "true"}}
+	},
+	"show": func(name string) manager.Command {
+		return manager.Command{Mode: "show", Name: name}
+	},
+	"clean": func(name string) manager.Command {
+		return manager.Command{Mode: "clean", Name: name}
+	},
+}
+
+// pickCommand lets the user choose a tracked window in a dmenu compatible
+// launcher and runs the selected action on it
+func pickCommand(fs *flag.FlagSet, g *globals) func(args []string) error {
+	action := fs.String("action", "toggle", "What to do with the chosen window: toggle, focus, show or clean")
+	hiddenOnly := fs.Bool("hidden", false, "Only offer hidden windows")
+	return noArgs(func(g *globals) error {
+		toCommand, ok := pickActions[*action]
+		if !ok {
+			return usagef("unknown pick action: %s", *action)
+		}
+
+		cfg, err := loadConfig(g)
+		if err != nil {
+			return err
+		}
+		m, err := newManager(cfg)
+		if err != nil {
+			return err
+		}
+		status, err := m.Status()
+		if err != nil {
+			return err
+		}
+		if *hiddenOnly {
+			status = hiddenStatus(status)
+		}
+		if len(status) == 0 {
+			return errors.New("no tracked windows to pick from")
+		}
+
+		picker, err := pickerCommand(cfg)
+		if err != nil {
+			return err
+		}
+		lines := pickLines(status)
+		choice, err := runPicker(picker, lines)
+		if err != nil || choice == "" {
+			return err
+		}
+		for i, line := range lines {
+			if line == choice {
+				return execute(g, toCommand(status[i].Name))
+			}
+		}
+		return fmt.Errorf("unknown choice: %s", choice)
+	})(fs, g)
+}
+
+func hiddenStatus(status []manager.WindowStatus) []manager.WindowStatus {
+	var hidden []manager.WindowStatus
+	for _, s := range status {
+		if s.State == manager.NotVisible.String() {
+			hidden = append(hidden, s)
+		}
+	}
+	return hidden
+}
+
+// pickLines renders one aligned line per window for the picker
+func pickLines(status []manager.WindowStatus) []string {
+	width := 0
+	for _, s := range status {
+		width = max(width, len(s.Name))
+	}
+	lines := make([]string, len(status))
+	for i, s := range status {
+		lines[i] = strings.TrimRight(fmt.Sprintf("%-*s  %-7s  %s", width, s.Name, s.State, s.Title), " ")
+	}
+	return lines
+}
+
+// pickerCommand returns the configured picker or the first default one that
+// is installed
+func pickerCommand(cfg *config.Config) ([]string, error) {
+	if len(cfg.Picker) > 0 {
+		return cfg.Picker, nil
+	}
+	for _, picker := range defaultPickers {
+		if _, err := exec.LookPath(picker[0]); err == nil {
+			return picker, nil
+		}
+	}
+	return nil, errors.New("no picker found, install rofi, fuzzel, wofi or dmenu or set picker in the config")
+}
+
+// runPicker offers lines on the picker's stdin and returns the chosen line.
+// Dismissing the picker, which dmenu compatible launchers report with a
+// non-zero exit status, returns "".
+func runPicker(picker []string, lines []string) (string, error) {
+	cmd := exec.Command(picker[0], picker[1:]...)
+	cmd.Stdin = strings.NewReader(strings.Join(lines, "\n") + "\n")
+	output, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("running picker %s: %v", picker[0], err)
+	}
+	return strings.TrimRight(string(output), "\n"), nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hellola/startorswitch/manager"
+)
+
+func TestPickLines(t *testing.T) {
+	lines := pickLines([]manager.WindowStatus{
+		{Name: "notes", State: "hidden", Title: "notes - Obsidian"},
+		{Name: "term", State: "visible"},
+	})
+	want := []string{
+		"notes  hidden   notes - Obsidian",
+		"term   visible",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("pickLines() = %q, want %q", lines, want)
+	}
+}
+
+func TestRunPicker(t *testing.T) {
+	lines := []string{"notes  hidden", "term   visible"}
+
+	choice, err := runPicker([]string{"sed", "-n", "2p"}, lines)
+	if err != nil {
+		t.Fatalf("runPicker() error = %v", err)
+	}
+	if choice != lines[1] {
+		t.Errorf("runPicker() = %q, want %q", choice, lines[1])
+	}
+
+	// dmenu exits with 1 when dismissed with escape
+	choice, err = runPicker([]string{"sh", "-c", "cat >/dev/null; exit 1"}, lines)
+	if err != nil || choice != "" {
+		t.Errorf("runPicker() dismissed = %q, %v, want no choice", choice, err)
+	}
+
+	if _, err := runPicker([]string{"startorswitch-no-such-picker"}, lines); err == nil {
+		t.Errorf("runPicker() with a missing picker succeeded")
+	}
+}
@@ -0,0 +1,88 @@
+package wm
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/hellola/startorswitch/config"
+)
+
+// launch starts the application's command in the background
+func launch(app config.App) (*exec.Cmd, error) {
+	cmd := exec.Command(app.Command, app.Args...)
+	if app.Dir != "" {
+		cmd.Dir = expandHome(os.ExpandEnv(app.Dir))
+	}
+	if len(app.Env) > 0 {
+		cmd.Env = os.Environ()
+		for key, value := range app.Env {
+			cmd.Env = append(cmd.Env, key+"="+os.ExpandEnv(value))
+		}
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start application: %v", err)
+	}
+	// Reap the process when it exits so long-running callers don't collect
+	// zombies
+	go cmd.Wait()
+	return cmd, nil
+}
+
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return home + path[1:]
+}
+
+// findOrStart returns the window of app from the windows reported by list,
+// starting the application and waiting for a window owned by the started
+// process tree when there is none
+func findOrStart(app config.App, list func() ([]Window, error)) (string, error) {
+	log.Printf("Finding or starting application: %s", app.Name)
+
+	matcher, err := NewMatcher(app)
+	if err != nil {
+		return "", err
+	}
+	windows, err := list()
+	if err != nil {
+		return "", err
+	}
+	if id := matcher.Find(windows); id != "" {
+		log.Printf("Found existing window for %s: %s", app.Name, id)
+		return id, nil
+	}
+
+	log.Printf("Starting application %s: %s %v", app.Name, app.Command, app.Args)
+	cmd, err := launch(app)
+	if err != nil {
+		log.Printf("Failed to start application %s: %v", app.Name, err)
+		return "", err
+	}
+
+	// Wait for window to appear
+	for i := 0; i < 10; i++ {
+		windows, err := list()
+		if err == nil {
+			matcher.SetProcessTree(cmd.Process.Pid)
+			if id := matcher.Find(windows); id != "" {
+				log.Printf("Found window after starting %s: %s", app.Name, id)
+				return id, nil
+			}
+		}
+		log.Printf("Attempt %d/10: Window not found yet, waiting...", i+1)
+		time.Sleep(time.Second)
+	}
+
+	log.Printf("Failed to find window for %s after starting", app.Name)
+	return "", fmt.Errorf("failed to find window after starting application")
+}
@@ -0,0 +1,25 @@
+package wm
+
+import (
+	"testing"
+
+	"github.com/hellola/startorswitch/config"
+)
+
+func TestConfig_App(t *testing.T) {
+	cfg := &config.Config{Apps: map[string]config.App{
+		"term": {Command: "kitty", Args: []string{"--class", "scratch-term"}, Match: config.Match{Class: "scratch-term"}},
+		"htop": {Match: config.Match{Title: "htop"}},
+	}}
+
+	term := cfg.App("term")
+	if term.Name != "term" || term.Command != "kitty" || len(term.Args) != 2 {
+		t.Errorf("App(term) = %+v", term)
+	}
+	if htop := cfg.App("htop"); htop.Command != "htop" {
+		t.Errorf("App(htop).Command = %q, want htop", htop.Command)
+	}
+	if other := cfg.App("firefox"); other.Command != "firefox" || !other.Match.IsZero() {
+		t.Errorf("App(firefox) = %+v, want the default app", other)
+	}
+}
@@ -1,28 +1,56 @@
 package wm
 
 import (
+	"bufio"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os/exec"
 	"strconv"
 	"strings"
-	"time"
+
+	"github.com/hellola/startorswitch/config"
 )
 
 // BSPWMIntegration implements WMIntegration for bspwm
-type BSPWMIntegration struct{}
+type BSPWMIntegration struct {
+	x *x11
+}
 
 // NewBSPWMIntegration creates a new BSPWM integration
 func NewBSPWMIntegration() *BSPWMIntegration {
-	return &BSPWMIntegration{}
+	return &BSPWMIntegration{x: &x11{}}
 }
 
+// Show moves the node to the focused desktop, which is on the focused
+// monitor, before unhiding and focusing it
 func (w *BSPWMIntegration) Show(nodeID string) error {
-	cmd := fmt.Sprintf("bspc node %s --flag hidden=off --flag sticky; bspc node -f %s", nodeID, nodeID)
+	home, err := exec.Command("bspc", "query", "-D", "-n", nodeID).Output()
+	if err != nil {
+		return fmt.Errorf("failed to find the desktop of node %s: %v", nodeID, err)
+	}
+	focused, err := exec.Command("bspc", "query", "-D", "-d", "focused").Output()
+	if err != nil {
+		return fmt.Errorf("failed to find the focused desktop: %v", err)
+	}
+	// bspc fails when asked to move a node to the desktop it is on
+	if strings.TrimSpace(string(home)) != strings.TrimSpace(string(focused)) {
+		if err := exec.Command("bspc", "node", nodeID, "--to-desktop", "focused").Run(); err != nil {
+			return fmt.Errorf("failed to move node %s to the focused desktop: %v", nodeID, err)
+		}
+	}
+	return w.Follow(nodeID, "")
+}
+
+// Follow unhides the node where it is and focuses it, which switches to its
+// desktop. Hidden nodes stay on their desktop, so workspace isn't needed.
+func (w *BSPWMIntegration) Follow(nodeID, workspace string) error {
+	cmd := fmt.Sprintf("bspc node %s --flag hidden=off; bspc node -f %s", nodeID, nodeID)
 	return exec.Command("sh", "-c", cmd).Run()
 }
 
 func (w *BSPWMIntegration) Hide(nodeID string) error {
-	cmd := fmt.Sprintf("bspc node %s --flag hidden=on --flag sticky", nodeID)
+	cmd := fmt.Sprintf("bspc node %s --flag hidden=on", nodeID)
 	return exec.Command("sh", "-c", cmd).Run()
 }
 
@@ -70,35 +98,177 @@ func (w *BSPWMIntegration) GetFocusedID() string {
 	return strings.TrimSpace(string(output))
 }
 
-func (w *BSPWMIntegration) FindOrStartApplication(name string) (string, error) {
-	// First try to find existing window
-	cmd := exec.Command("xdotool", "search", "--name", name)
-	output, err := cmd.Output()
-	if err == nil && len(output) > 0 {
-		ids := strings.Split(strings.TrimSpace(string(output)), "\n")
-		if len(ids) > 0 {
-			return ids[0], nil
+// Windows returns every window node, reading its properties from X since
+// bspwm node IDs are X window IDs
+func (w *BSPWMIntegration) Windows() ([]Window, error) {
+	output, err := exec.Command("bspc", "query", "-N", "-n", ".window").Output()
+	if err != nil {
+		return nil, err
+	}
+	if err := w.x.connect(); err != nil {
+		return nil, err
+	}
+	var windows []Window
+	for _, node := range strings.Fields(string(output)) {
+		win, err := parseWindowID(node)
+		if err != nil {
+			continue
 		}
+		windows = append(windows, w.x.info(win))
+	}
+	return windows, nil
+}
+
+func (w *BSPWMIntegration) FindOrStartApplication(app config.App) (string, error) {
+	return findOrStart(app, w.Windows)
+}
+
+// SetModifier sets the sticky flag, the floating or fullscreen state
+// (falling back to tiled) or the above layer of a node
+func (w *BSPWMIntegration) SetModifier(nodeID string, mod Modifier, on bool) error {
+	var args []string
+	switch mod {
+	case Sticky:
+		args = []string{"--flag", "sticky=" + onOff(on, "on", "off")}
+	case Floating:
+		args = []string{"--state", onOff(on, "floating", "tiled")}
+	case Fullscreen:
+		args = []string{"--state", onOff(on, "fullscreen", "tiled")}
+	case Above:
+		args = []string{"--layer", onOff(on, "above", "normal")}
+	default:
+		return unsupportedModifier("bspwm", mod)
 	}
+	return exec.Command("bspc", append([]string{"node", nodeID}, args...)...).Run()
+}
+
+// SetTopPadding sets the top padding of the focused monitor
+func (w *BSPWMIntegration) SetTopPadding(pixels int) error {
+	return exec.Command("bspc", "config", "-m", "focused", "top_padding", strconv.Itoa(pixels)).Run()
+}
+
+// bspwmMonitor is the part of a monitor tree (bspc query -T -m) needed to
+// place windows
+type bspwmMonitor struct {
+	Rectangle Rect `json:"rectangle"`
+	Padding   struct {
+		Top    int `json:"top"`
+		Right  int `json:"right"`
+		Bottom int `json:"bottom"`
+		Left   int `json:"left"`
+	} `json:"padding"`
+}
+
+// bspwmNode is the part of a node tree (bspc query -T -n) needed to place
+// windows
+type bspwmNode struct {
+	Client *struct {
+		State             string `json:"state"`
+		FloatingRectangle Rect   `json:"floatingRectangle"`
+	} `json:"client"`
+}
 
-	// Start the application
-	cmd = exec.Command(name)
+// Place floats the node and moves it onto the focused monitor, inside its
+// padding
+func (w *BSPWMIntegration) Place(nodeID string, geometry config.Geometry) error {
+	monitor, err := exec.Command("bspc", "query", "-T", "-m").Output()
+	if err != nil {
+		return fmt.Errorf("failed to query the focused monitor: %v", err)
+	}
+	node, err := exec.Command("bspc", "query", "-T", "-n", nodeID).Output()
+	if err != nil {
+		return fmt.Errorf("failed to query node %s: %v", nodeID, err)
+	}
+	args, err := bspwmPlaceArgs(nodeID, monitor, node, geometry)
+	if err != nil || args == nil {
+		return err
+	}
+	return exec.Command("bspc", args...).Run()
+}
+
+// bspwmPlaceArgs returns the bspc arguments that float the node and move
+// and resize it from its floating rectangle to where geometry puts it, or
+// nil if it is already there. bspc can only move and resize relatively.
+func bspwmPlaceArgs(nodeID string, monitorTree, nodeTree []byte, geometry config.Geometry) ([]string, error) {
+	var monitor bspwmMonitor
+	if err := json.Unmarshal(monitorTree, &monitor); err != nil {
+		return nil, err
+	}
+	var node bspwmNode
+	if err := json.Unmarshal(nodeTree, &node); err != nil {
+		return nil, err
+	}
+	if node.Client == nil {
+		return nil, fmt.Errorf("node %s is not a window", nodeID)
+	}
+	area := Rect{
+		X:      monitor.Rectangle.X + monitor.Padding.Left,
+		Y:      monitor.Rectangle.Y + monitor.Padding.Top,
+		Width:  monitor.Rectangle.Width - monitor.Padding.Left - monitor.Padding.Right,
+		Height: monitor.Rectangle.Height - monitor.Padding.Top - monitor.Padding.Bottom,
+	}
+	target, err := placeRect(geometry, area)
+	if err != nil {
+		return nil, err
+	}
+
+	current := node.Client.FloatingRectangle
+	var args []string
+	if node.Client.State != "floating" {
+		args = append(args, "--state", "floating")
+	}
+	if dx, dy := target.X-current.X, target.Y-current.Y; dx != 0 || dy != 0 {
+		args = append(args, "--move", strconv.Itoa(dx), strconv.Itoa(dy))
+	}
+	if dw, dh := target.Width-current.Width, target.Height-current.Height; dw != 0 || dh != 0 {
+		args = append(args, "--resize", "bottom_right", strconv.Itoa(dw), strconv.Itoa(dh))
+	}
+	if args == nil {
+		return nil, nil
+	}
+	return append([]string{"node", nodeID}, args...), nil
+}
+
+// Watch follows bspc subscribe for removed nodes and changes to the hidden
+// flag
+func (w *BSPWMIntegration) Watch(handle func(Event)) error {
+	cmd := exec.Command("bspc", "subscribe", "node_remove", "node_flag")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
 	if err := cmd.Start(); err != nil {
-		return "", fmt.Errorf("failed to start application: %v", err)
+		return fmt.Errorf("failed to subscribe to bspwm events: %v", err)
+	}
+	if err := parseBSPWMEvents(stdout, handle); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
 	}
+	return cmd.Wait()
+}
 
-	// Wait for window to appear
-	for i := 0; i < 5; i++ {
-		cmd := exec.Command("xdotool", "search", "--name", name)
-		output, err := cmd.Output()
-		if err == nil && len(output) > 0 {
-			ids := strings.Split(strings.TrimSpace(string(output)), "\n")
-			if len(ids) > 0 {
-				return ids[0], nil
+// parseBSPWMEvents reads bspc subscribe output, one event per line:
+//
+//	node_remove <monitor_id> <desktop_id> <node_id>
+//	node_flag <monitor_id> <desktop_id> <node_id> <flag> on|off
+func parseBSPWMEvents(r io.Reader, handle func(Event)) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		switch {
+		case fields[0] == "node_remove":
+			handle(Event{Type: EventClosed, NodeID: fields[3]})
+		case fields[0] == "node_flag" && len(fields) == 6 && fields[4] == "hidden":
+			event := Event{Type: EventShown, NodeID: fields[3]}
+			if fields[5] == "on" {
+				event.Type = EventHidden
 			}
+			handle(event)
 		}
-		time.Sleep(time.Second)
 	}
-
-	return "", fmt.Errorf("failed to find window after starting application")
+	return scanner.Err()
 }
@@ -0,0 +1,67 @@
+package wm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hellola/startorswitch/config"
+)
+
+// recordedBSPWMEvents is output of bspc subscribe node_remove node_flag
+// while hiding, showing, making sticky and closing windows
+const recordedBSPWMEvents = `node_flag 0x00200002 0x00200006 0x04A00003 hidden on
+node_flag 0x00200002 0x00200006 0x04A00003 sticky on
+node_flag 0x00200002 0x00200006 0x04A00003 hidden off
+node_remove 0x00200002 0x00200006 0x05000002
+`
+
+func TestParseBSPWMEvents(t *testing.T) {
+	var events []Event
+	err := parseBSPWMEvents(strings.NewReader(recordedBSPWMEvents), func(e Event) {
+		events = append(events, e)
+	})
+	if err != nil {
+		t.Fatalf("parseBSPWMEvents() error = %v", err)
+	}
+	want := []Event{
+		{Type: EventHidden, NodeID: "0x04A00003"},
+		{Type: EventShown, NodeID: "0x04A00003"},
+		{Type: EventClosed, NodeID: "0x05000002"},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+}
+
+// recordedBSPWMMonitor is trimmed output of bspc query -T -m on a second
+// monitor with a bar reserving top_padding
+const recordedBSPWMMonitor = `{"name":"HDMI-1-1","id":2097154,"randrId":68,"wired":true,
+"padding":{"top":30,"right":0,"bottom":0,"left":0},
+"rectangle":{"x":1920,"y":0,"width":1920,"height":1080},"desktops":[]}`
+
+const recordedBSPWMTiledNode = `{"id":77594627,"client":{"className":"kitty","instanceName":"kitty",
+"state":"tiled","layer":"normal","floatingRectangle":{"x":100,"y":100,"width":800,"height":600},
+"tiledRectangle":{"x":1920,"y":30,"width":960,"height":1050}}}`
+
+func TestBSPWMPlaceArgs(t *testing.T) {
+	geometry := config.Geometry{Width: "100%", Height: "40%", Anchor: "top"}
+	args, err := bspwmPlaceArgs("0x04A00003", []byte(recordedBSPWMMonitor), []byte(recordedBSPWMTiledNode), geometry)
+	if err != nil {
+		t.Fatalf("bspwmPlaceArgs() error = %v", err)
+	}
+	want := []string{"node", "0x04A00003", "--state", "floating", "--move", "1820", "-70", "--resize", "bottom_right", "1120", "-180"}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("bspwmPlaceArgs() = %q, want %q", args, want)
+	}
+
+	placed := `{"client":{"state":"floating","floatingRectangle":{"x":1920,"y":30,"width":1920,"height":420}}}`
+	args, err = bspwmPlaceArgs("0x04A00003", []byte(recordedBSPWMMonitor), []byte(placed), geometry)
+	if err != nil || args != nil {
+		t.Errorf("bspwmPlaceArgs() of a placed window = %q, %v, want nothing to do", args, err)
+	}
+
+	if _, err := bspwmPlaceArgs("0x00200006", []byte(recordedBSPWMMonitor), []byte(`{"id":2097158,"client":null}`), geometry); err == nil {
+		t.Errorf("bspwmPlaceArgs() of a non-window node error = nil")
+	}
+}
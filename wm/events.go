@@ -0,0 +1,28 @@
+package wm
+
+// EventType identifies a change made to a window outside of startorswitch
+type EventType int
+
+const (
+	// EventClosed means the window no longer exists
+	EventClosed EventType = iota
+	// EventShown means the window became visible
+	EventShown
+	// EventHidden means the window was hidden
+	EventHidden
+)
+
+// Event reports a change to the window identified by NodeID, in the same
+// form the other WMIntegration methods use
+type Event struct {
+	Type   EventType
+	NodeID string
+}
+
+// EventSource is implemented by backends that can report window changes as
+// they happen
+type EventSource interface {
+	// Watch calls handle for every event until the event stream ends or
+	// fails
+	Watch(handle func(Event)) error
+}
@@ -0,0 +1,239 @@
+package wm
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/hellola/startorswitch/config"
+	"github.com/jezek/xgb/xproto"
+)
+
+const (
+	// ewmhSourcePager marks client messages as coming from a pager, which
+	// window managers honour without focus stealing prevention
+	ewmhSourcePager = 2
+	// icccmIconicState is the WM_CHANGE_STATE value requesting iconification
+	icccmIconicState = 3
+	// ewmhAllDesktops is the _NET_WM_DESKTOP value of sticky windows
+	ewmhAllDesktops = 0xFFFFFFFF
+	// ewmhStateRemove and ewmhStateAdd are _NET_WM_STATE actions
+	ewmhStateRemove = 0
+	ewmhStateAdd    = 1
+	// ewmhMoveResizeFlags makes _NET_MOVERESIZE_WINDOW set x, y, width and
+	// height (bits 8-11) on behalf of a pager (bits 12-15), keeping the
+	// window's gravity
+	ewmhMoveResizeFlags = 0xF<<8 | ewmhSourcePager<<12
+)
+
+// ewmhStates maps modifiers to their _NET_WM_STATE atoms. EWMH has no
+// notion of tiling, so Floating is unsupported.
+var ewmhStates = map[Modifier]string{
+	Sticky:     "_NET_WM_STATE_STICKY",
+	Above:      "_NET_WM_STATE_ABOVE",
+	Fullscreen: "_NET_WM_STATE_FULLSCREEN",
+}
+
+// EWMHIntegration implements WMIntegration for any window manager following
+// the EWMH and ICCCM specifications by talking to the X server directly.
+// Hidden windows are minimized and window IDs are X window IDs.
+type EWMHIntegration struct {
+	x *x11
+}
+
+// NewEWMHIntegration creates a new EWMH integration
+func NewEWMHIntegration() *EWMHIntegration {
+	log.Printf("Creating new ewmh integration")
+	return &EWMHIntegration{x: &x11{}}
+}
+
+func (w *EWMHIntegration) window(nodeID string) (xproto.Window, error) {
+	if err := w.x.connect(); err != nil {
+		return 0, err
+	}
+	return parseWindowID(nodeID)
+}
+
+// clients returns _NET_CLIENT_LIST
+func (w *EWMHIntegration) clients() ([]xproto.Window, error) {
+	if err := w.x.connect(); err != nil {
+		return nil, err
+	}
+	values, err := w.x.cardinals(w.x.root, "_NET_CLIENT_LIST")
+	if err != nil {
+		return nil, err
+	}
+	clients := make([]xproto.Window, len(values))
+	for i, value := range values {
+		clients[i] = xproto.Window(value)
+	}
+	return clients, nil
+}
+
+func (w *EWMHIntegration) Show(nodeID string) error {
+	log.Printf("Showing ewmh window: %s", nodeID)
+	win, err := w.window(nodeID)
+	if err != nil {
+		return err
+	}
+
+	// Bring the window to the current desktop before activating it,
+	// otherwise most window managers switch to the window's desktop instead
+	current, ok := w.x.cardinal(w.x.root, "_NET_CURRENT_DESKTOP")
+	desktop, hasDesktop := w.x.cardinal(win, "_NET_WM_DESKTOP")
+	if ok && hasDesktop && desktop != current && desktop != ewmhAllDesktops {
+		if err := w.x.clientMessage(win, "_NET_WM_DESKTOP", current, ewmhSourcePager); err != nil {
+			return err
+		}
+	}
+	return w.Focus(nodeID)
+}
+
+// Follow activates the window on the desktop it is on, which makes the
+// window manager switch there. Minimized windows stay on their desktop, so
+// workspace isn't needed.
+func (w *EWMHIntegration) Follow(nodeID, workspace string) error {
+	log.Printf("Following ewmh window: %s", nodeID)
+	return w.Focus(nodeID)
+}
+
+func (w *EWMHIntegration) Hide(nodeID string) error {
+	log.Printf("Hiding ewmh window: %s", nodeID)
+	win, err := w.window(nodeID)
+	if err != nil {
+		return err
+	}
+	return w.x.clientMessage(win, "WM_CHANGE_STATE", icccmIconicState)
+}
+
+// IsHidden reports whether the window manager has marked the window with
+// _NET_WM_STATE_HIDDEN, which it does for minimized windows
+func (w *EWMHIntegration) IsHidden(nodeID string) (bool, error) {
+	win, err := w.window(nodeID)
+	if err != nil {
+		return false, err
+	}
+	hidden, err := w.x.atom("_NET_WM_STATE_HIDDEN")
+	if err != nil {
+		return false, err
+	}
+	states, err := w.x.cardinals(win, "_NET_WM_STATE")
+	if err != nil {
+		return false, err
+	}
+	for _, state := range states {
+		if xproto.Atom(state) == hidden {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (w *EWMHIntegration) StillAlive(nodeID string) bool {
+	win, err := parseWindowID(nodeID)
+	if err != nil {
+		return false
+	}
+	clients, err := w.clients()
+	if err != nil {
+		log.Printf("Error getting client list: %v", err)
+		return false
+	}
+	for _, client := range clients {
+		if client == win {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *EWMHIntegration) Focus(nodeID string) error {
+	log.Printf("Focusing ewmh window: %s", nodeID)
+	win, err := w.window(nodeID)
+	if err != nil {
+		return err
+	}
+	return w.x.clientMessage(win, "_NET_ACTIVE_WINDOW", ewmhSourcePager, xproto.TimeCurrentTime)
+}
+
+func (w *EWMHIntegration) IsFocused(nodeID string) bool {
+	return w.GetFocusedID() == nodeID
+}
+
+func (w *EWMHIntegration) GetFocusedID() string {
+	if err := w.x.connect(); err != nil {
+		log.Printf("Error connecting to X: %v", err)
+		return ""
+	}
+	active, ok := w.x.cardinal(w.x.root, "_NET_ACTIVE_WINDOW")
+	if !ok || active == 0 {
+		return ""
+	}
+	return formatWindowID(xproto.Window(active))
+}
+
+// Windows returns the managed client windows
+func (w *EWMHIntegration) Windows() ([]Window, error) {
+	clients, err := w.clients()
+	if err != nil {
+		return nil, err
+	}
+	windows := make([]Window, len(clients))
+	for i, client := range clients {
+		windows[i] = w.x.info(client)
+	}
+	return windows, nil
+}
+
+func (w *EWMHIntegration) FindOrStartApplication(app config.App) (string, error) {
+	return findOrStart(app, w.Windows)
+}
+
+// SetModifier asks the window manager to add or remove the _NET_WM_STATE
+// matching mod
+func (w *EWMHIntegration) SetModifier(nodeID string, mod Modifier, on bool) error {
+	name, ok := ewmhStates[mod]
+	if !ok {
+		return unsupportedModifier("ewmh", mod)
+	}
+	win, err := w.window(nodeID)
+	if err != nil {
+		return err
+	}
+	state, err := w.x.atom(name)
+	if err != nil {
+		return err
+	}
+	action := uint32(ewmhStateRemove)
+	if on {
+		action = ewmhStateAdd
+	}
+	return w.x.clientMessage(win, "_NET_WM_STATE", action, uint32(state), 0, ewmhSourcePager)
+}
+
+// Place moves and resizes the window within the work area of the current
+// desktop. EWMH has no notion of monitors, so on multi-monitor setups the
+// work area spans all of them.
+func (w *EWMHIntegration) Place(nodeID string, geometry config.Geometry) error {
+	win, err := w.window(nodeID)
+	if err != nil {
+		return err
+	}
+	workarea, err := w.x.cardinals(w.x.root, "_NET_WORKAREA")
+	if err != nil {
+		return err
+	}
+	if len(workarea) < 4 {
+		return fmt.Errorf("_NET_WORKAREA is not set")
+	}
+	current, _ := w.x.cardinal(w.x.root, "_NET_CURRENT_DESKTOP")
+	if int(current)*4+4 > len(workarea) {
+		current = 0
+	}
+	area := workarea[current*4 : current*4+4]
+	target, err := placeRect(geometry, Rect{X: int(area[0]), Y: int(area[1]), Width: int(area[2]), Height: int(area[3])})
+	if err != nil {
+		return err
+	}
+	return w.x.clientMessage(win, "_NET_MOVERESIZE_WINDOW", ewmhMoveResizeFlags,
+		uint32(target.X), uint32(target.Y), uint32(target.Width), uint32(target.Height))
+}
@@ -0,0 +1,158 @@
+package wm
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/hellola/startorswitch/config"
+	"github.com/jezek/xgb/xproto"
+)
+
+// newTestEWMH connects to the X server named by
+// STARTORSWITCH_X11_TEST_DISPLAY, skipping the test when it is unset. The
+// tests rewrite root window properties such as _NET_CLIENT_LIST, so they
+// never use $DISPLAY and must point at a throwaway server like Xvfb.
+func newTestEWMH(t *testing.T) *EWMHIntegration {
+	t.Helper()
+	display := os.Getenv("STARTORSWITCH_X11_TEST_DISPLAY")
+	if display == "" {
+		t.Skip("STARTORSWITCH_X11_TEST_DISPLAY not set, point it at an Xvfb display to test the EWMH backend")
+	}
+	w := NewEWMHIntegration()
+	w.x.display = display
+	if err := w.x.connect(); err != nil {
+		t.Skipf("X server not available: %v", err)
+	}
+	t.Cleanup(w.x.Close)
+	return w
+}
+
+// createClient creates an unmapped window with the given WM_CLASS and title
+func createClient(t *testing.T, x *x11, instance, class, title string) xproto.Window {
+	t.Helper()
+	win, err := xproto.NewWindowId(x.conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	screen := xproto.Setup(x.conn).DefaultScreen(x.conn)
+	err = xproto.CreateWindowChecked(x.conn, screen.RootDepth, win, x.root, 0, 0, 100, 100, 0,
+		xproto.WindowClassInputOutput, screen.RootVisual, 0, nil).Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { xproto.DestroyWindow(x.conn, win) })
+
+	wmClass := instance + "\x00" + class + "\x00"
+	xproto.ChangeProperty(x.conn, xproto.PropModeReplace, win, xproto.AtomWmClass, xproto.AtomString, 8, uint32(len(wmClass)), []byte(wmClass))
+	xproto.ChangeProperty(x.conn, xproto.PropModeReplace, win, xproto.AtomWmName, xproto.AtomString, 8, uint32(len(title)), []byte(title))
+	return win
+}
+
+// setRootWindows sets a WINDOW list property on the root window the way an
+// EWMH window manager would
+func setRootWindows(t *testing.T, x *x11, name string, wins ...xproto.Window) {
+	t.Helper()
+	atom, err := x.atom(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 4*len(wins))
+	for i, win := range wins {
+		binary.LittleEndian.PutUint32(data[i*4:], uint32(win))
+	}
+	err = xproto.ChangePropertyChecked(x.conn, xproto.PropModeReplace, x.root, atom, xproto.AtomWindow, 32, uint32(len(wins)), data).Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEWMHIntegration_Lookup(t *testing.T) {
+	w := newTestEWMH(t)
+	term := createClient(t, w.x, "scratch-term", "kitty", "~")
+	chat := createClient(t, w.x, "slack", "Slack", "Slack | general")
+	setRootWindows(t, w.x, "_NET_CLIENT_LIST", term, chat)
+	setRootWindows(t, w.x, "_NET_ACTIVE_WINDOW", chat)
+
+	if got := w.GetFocusedID(); got != formatWindowID(chat) {
+		t.Errorf("GetFocusedID() = %s, want %s", got, formatWindowID(chat))
+	}
+	if !w.StillAlive(formatWindowID(term)) {
+		t.Errorf("StillAlive() = false for a listed client")
+	}
+	if w.StillAlive("0x00000001") {
+		t.Errorf("StillAlive() = true for an unlisted window")
+	}
+
+	tests := []struct {
+		name string
+		want xproto.Window
+	}{
+		{"kitty", term},
+		{"scratch-term", term},
+		{"slack", chat},
+		{"general", chat},
+	}
+	for _, tt := range tests {
+		got, err := w.FindOrStartApplication(config.DefaultApp(tt.name))
+		if err != nil {
+			t.Fatalf("FindOrStartApplication(%s) error = %v", tt.name, err)
+		}
+		if got != formatWindowID(tt.want) {
+			t.Errorf("FindOrStartApplication(%s) = %s, want %s", tt.name, got, formatWindowID(tt.want))
+		}
+	}
+}
+
+func TestEWMHIntegration_IsHidden(t *testing.T) {
+	w := newTestEWMH(t)
+	term := createClient(t, w.x, "scratch-term", "kitty", "~")
+	setRootWindows(t, w.x, "_NET_CLIENT_LIST", term)
+
+	if hidden, err := w.IsHidden(formatWindowID(term)); err != nil || hidden {
+		t.Errorf("IsHidden() = %v, %v before minimizing, want false", hidden, err)
+	}
+
+	state, err := w.x.atom("_NET_WM_STATE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hiddenAtom, err := w.x.atom("_NET_WM_STATE_HIDDEN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 4)
+	binary.LittleEndian.PutUint32(data, uint32(hiddenAtom))
+	err = xproto.ChangePropertyChecked(w.x.conn, xproto.PropModeReplace, term, state, xproto.AtomAtom, 32, 1, data).Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hidden, err := w.IsHidden(formatWindowID(term)); err != nil || !hidden {
+		t.Errorf("IsHidden() = %v, %v after minimizing, want true", hidden, err)
+	}
+}
+
+func TestParseWindowID(t *testing.T) {
+	tests := []struct {
+		id      string
+		want    xproto.Window
+		wantErr bool
+	}{
+		{"0x0240000A", 0x0240000A, false},
+		{"37748746", 37748746, false},
+		{"", 0, true},
+		{"node", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseWindowID(tt.id)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseWindowID(%q) error = %v, wantErr %v", tt.id, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("parseWindowID(%q) = %d, want %d", tt.id, got, tt.want)
+		}
+	}
+	if got := formatWindowID(0x0240000A); got != "0x0240000A" {
+		t.Errorf("formatWindowID() = %s, want 0x0240000A", got)
+	}
+}
@@ -21,6 +21,12 @@ func (f *Factory) CreateWM(cfg *config.Config) (WMIntegration, error) {
 		return NewBSPWMIntegration(), nil
 	case "i3":
 		return NewI3Integration(), nil
+	case "sway":
+		return NewSwayIntegration(), nil
+	case "hyprland":
+		return NewHyprlandIntegration(), nil
+	case "ewmh":
+		return NewEWMHIntegration(), nil
 	default:
 		return nil, fmt.Errorf("unsupported window manager: %s", cfg.WindowManager)
 	}
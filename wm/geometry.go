@@ -0,0 +1,81 @@
+package wm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hellola/startorswitch/config"
+)
+
+// Rect is a rectangle in screen coordinates
+type Rect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// Placer is implemented by backends that can float a window and move and
+// resize it onto the focused monitor
+type Placer interface {
+	Place(nodeID string, geometry config.Geometry) error
+}
+
+// placeRect works out where geometry puts a window on a monitor whose
+// usable area is monitor
+func placeRect(geometry config.Geometry, monitor Rect) (Rect, error) {
+	width, err := parseLength(geometry.Width, monitor.Width)
+	if err != nil {
+		return Rect{}, fmt.Errorf("invalid width: %v", err)
+	}
+	height, err := parseLength(geometry.Height, monitor.Height)
+	if err != nil {
+		return Rect{}, fmt.Errorf("invalid height: %v", err)
+	}
+
+	// Center unless the anchor pins a side
+	x := monitor.X + (monitor.Width-width)/2
+	y := monitor.Y + (monitor.Height-height)/2
+	anchor := geometry.Anchor
+	if anchor == "" {
+		anchor = "center"
+	}
+	if anchor != "center" {
+		for _, side := range strings.Split(anchor, "-") {
+			switch side {
+			case "top":
+				y = monitor.Y
+			case "bottom":
+				y = monitor.Y + monitor.Height - height
+			case "left":
+				x = monitor.X
+			case "right":
+				x = monitor.X + monitor.Width - width
+			default:
+				return Rect{}, fmt.Errorf("invalid anchor: %s", geometry.Anchor)
+			}
+		}
+	}
+	return Rect{X: x + geometry.OffsetX, Y: y + geometry.OffsetY, Width: width, Height: height}, nil
+}
+
+// parseLength parses pixels ("800") or a percentage of total ("40%"),
+// defaulting to half of total
+func parseLength(value string, total int) (int, error) {
+	if value == "" {
+		return total / 2, nil
+	}
+	if percent, ok := strings.CutSuffix(value, "%"); ok {
+		p, err := strconv.ParseFloat(percent, 64)
+		if err != nil || p <= 0 || p > 100 {
+			return 0, fmt.Errorf("%q is not a percentage", value)
+		}
+		return int(float64(total) * p / 100), nil
+	}
+	pixels, err := strconv.Atoi(strings.TrimSuffix(value, "px"))
+	if err != nil || pixels <= 0 {
+		return 0, fmt.Errorf("%q is not a size in pixels", value)
+	}
+	return pixels, nil
+}
@@ -0,0 +1,64 @@
+package wm
+
+import (
+	"testing"
+
+	"github.com/hellola/startorswitch/config"
+)
+
+func TestPlaceRect(t *testing.T) {
+	// A 1920x1080 monitor right of another one, with a 30px bar on top
+	monitor := Rect{X: 1920, Y: 30, Width: 1920, Height: 1050}
+	tests := []struct {
+		name     string
+		geometry config.Geometry
+		want     Rect
+		wantErr  bool
+	}{
+		{
+			name: "defaults to half the monitor in the center",
+			want: Rect{X: 2400, Y: 292, Width: 960, Height: 525},
+		},
+		{
+			name:     "quake style terminal at the top",
+			geometry: config.Geometry{Width: "100%", Height: "40%", Anchor: "top"},
+			want:     Rect{X: 1920, Y: 30, Width: 1920, Height: 420},
+		},
+		{
+			name:     "pixels in a corner with offsets",
+			geometry: config.Geometry{Width: "800", Height: "600px", Anchor: "bottom-right", OffsetX: -10, OffsetY: -10},
+			want:     Rect{X: 3030, Y: 470, Width: 800, Height: 600},
+		},
+		{
+			name:     "left edge stays vertically centered",
+			geometry: config.Geometry{Width: "25%", Height: "100%", Anchor: "left"},
+			want:     Rect{X: 1920, Y: 30, Width: 480, Height: 1050},
+		},
+		{
+			name:     "unknown anchor",
+			geometry: config.Geometry{Anchor: "middle"},
+			wantErr:  true,
+		},
+		{
+			name:     "bad percentage",
+			geometry: config.Geometry{Width: "150%"},
+			wantErr:  true,
+		},
+		{
+			name:     "bad size",
+			geometry: config.Geometry{Height: "tall"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := placeRect(tt.geometry, monitor)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("placeRect() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("placeRect() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
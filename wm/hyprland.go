@@ -0,0 +1,307 @@
+package wm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hellola/startorswitch/config"
+)
+
+// hyprlandSpecialWorkspace is the special workspace hidden windows are moved to
+const hyprlandSpecialWorkspace = "startorswitch"
+
+// hyprlandClient is one entry of the clients reply
+type hyprlandClient struct {
+	Address      string `json:"address"`
+	Class        string `json:"class"`
+	Title        string `json:"title"`
+	InitialClass string `json:"initialClass"`
+	PID          int    `json:"pid"`
+	Floating     bool   `json:"floating"`
+	Pinned       bool   `json:"pinned"`
+	Workspace    struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"workspace"`
+}
+
+// hyprlandWorkspace is the activeworkspace reply
+type hyprlandWorkspace struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// hyprlandMonitor is one entry of the monitors reply
+type hyprlandMonitor struct {
+	Name             string            `json:"name"`
+	Focused          bool              `json:"focused"`
+	SpecialWorkspace hyprlandWorkspace `json:"specialWorkspace"`
+	X                int               `json:"x"`
+	Y                int               `json:"y"`
+	Width            int               `json:"width"`
+	Height           int               `json:"height"`
+	Scale            float64           `json:"scale"`
+	// Reserved is the space taken by bars: left, top, right, bottom
+	Reserved [4]int `json:"reserved"`
+}
+
+// area returns the part of the monitor left to windows in layout
+// coordinates, which are scaled down from the reported pixel size
+func (m hyprlandMonitor) area() Rect {
+	scale := m.Scale
+	if scale <= 0 {
+		scale = 1
+	}
+	return Rect{
+		X:      m.X + m.Reserved[0],
+		Y:      m.Y + m.Reserved[1],
+		Width:  int(float64(m.Width)/scale) - m.Reserved[0] - m.Reserved[2],
+		Height: int(float64(m.Height)/scale) - m.Reserved[1] - m.Reserved[3],
+	}
+}
+
+// HyprlandIntegration implements WMIntegration for Hyprland. Hidden windows
+// live on a special workspace and window IDs are Hyprland client addresses.
+type HyprlandIntegration struct {
+	socketPath func() (string, error)
+}
+
+// NewHyprlandIntegration creates a new Hyprland integration
+func NewHyprlandIntegration() *HyprlandIntegration {
+	log.Printf("Creating new hyprland integration")
+	return &HyprlandIntegration{socketPath: hyprlandSocketPath}
+}
+
+// hyprlandSocketPath returns the request socket of the running Hyprland
+// instance. Hyprland 0.40 moved it from /tmp/hypr to $XDG_RUNTIME_DIR/hypr.
+func hyprlandSocketPath() (string, error) {
+	signature := os.Getenv("HYPRLAND_INSTANCE_SIGNATURE")
+	if signature == "" {
+		return "", fmt.Errorf("HYPRLAND_INSTANCE_SIGNATURE is not set")
+	}
+	var candidates []string
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		candidates = append(candidates, filepath.Join(runtimeDir, "hypr", signature, ".socket.sock"))
+	}
+	candidates = append(candidates, filepath.Join("/tmp", "hypr", signature, ".socket.sock"))
+	for _, path := range candidates {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("failed to find hyprland socket for instance %s", signature)
+}
+
+// request sends a single request to Hyprland and returns the reply. Hyprland
+// closes the connection after every reply.
+func (w *HyprlandIntegration) request(req string) ([]byte, error) {
+	path, err := w.socketPath()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(req)); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(conn)
+}
+
+// requestJSON sends a JSON request such as "clients" and decodes the reply
+func (w *HyprlandIntegration) requestJSON(req string, v interface{}) error {
+	reply, err := w.request("j/" + req)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(reply, v)
+}
+
+// dispatch runs a Hyprland dispatcher
+func (w *HyprlandIntegration) dispatch(args string) error {
+	log.Printf("Executing hyprland dispatch: %s", args)
+	reply, err := w.request("dispatch " + args)
+	if err != nil {
+		return err
+	}
+	if result := strings.TrimSpace(string(reply)); result != "ok" {
+		return fmt.Errorf("hyprland dispatch %q failed: %s", args, result)
+	}
+	return nil
+}
+
+func (w *HyprlandIntegration) clients() ([]hyprlandClient, error) {
+	var clients []hyprlandClient
+	if err := w.requestJSON("clients", &clients); err != nil {
+		log.Printf("Error getting hyprland clients: %v", err)
+		return nil, err
+	}
+	return clients, nil
+}
+
+func (w *HyprlandIntegration) Show(nodeID string) error {
+	log.Printf("Showing hyprland window with address: %s", nodeID)
+	var active hyprlandWorkspace
+	if err := w.requestJSON("activeworkspace", &active); err != nil {
+		return err
+	}
+	// Named workspaces have negative IDs, which the dispatcher would read
+	// as a relative move, so the workspace is addressed by name
+	if err := w.dispatch(fmt.Sprintf("movetoworkspacesilent name:%s,address:%s", active.Name, nodeID)); err != nil {
+		return err
+	}
+
+	// If the special workspace was toggled open by hand, close it again so
+	// the remaining hidden windows stay hidden
+	var monitors []hyprlandMonitor
+	if err := w.requestJSON("monitors", &monitors); err != nil {
+		return err
+	}
+	for _, monitor := range monitors {
+		if monitor.Focused && monitor.SpecialWorkspace.Name == "special:"+hyprlandSpecialWorkspace {
+			if err := w.dispatch("togglespecialworkspace " + hyprlandSpecialWorkspace); err != nil {
+				return err
+			}
+		}
+	}
+	return w.Focus(nodeID)
+}
+
+// Follow moves the window from the special workspace back to workspace,
+// where it was before it was hidden, switching there with it. Without a
+// workspace the window is shown like Show does.
+func (w *HyprlandIntegration) Follow(nodeID, workspace string) error {
+	log.Printf("Following hyprland window %s to workspace %s", nodeID, workspace)
+	if workspace == "" {
+		return w.Show(nodeID)
+	}
+	if err := w.dispatch(fmt.Sprintf("movetoworkspace name:%s,address:%s", workspace, nodeID)); err != nil {
+		return err
+	}
+	return w.Focus(nodeID)
+}
+
+func (w *HyprlandIntegration) Hide(nodeID string) error {
+	log.Printf("Hiding hyprland window with address: %s", nodeID)
+	return w.dispatch(fmt.Sprintf("movetoworkspacesilent special:%s,address:%s", hyprlandSpecialWorkspace, nodeID))
+}
+
+func (w *HyprlandIntegration) StillAlive(nodeID string) bool {
+	clients, err := w.clients()
+	if err != nil {
+		return false
+	}
+	for _, client := range clients {
+		if client.Address == nodeID {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *HyprlandIntegration) Focus(nodeID string) error {
+	log.Printf("Focusing hyprland window with address: %s", nodeID)
+	return w.dispatch("focuswindow address:" + nodeID)
+}
+
+func (w *HyprlandIntegration) IsFocused(nodeID string) bool {
+	return w.GetFocusedID() == nodeID
+}
+
+func (w *HyprlandIntegration) GetFocusedID() string {
+	var active hyprlandClient
+	if err := w.requestJSON("activewindow", &active); err != nil {
+		log.Printf("Error getting hyprland active window: %v", err)
+		return ""
+	}
+	return active.Address
+}
+
+// Windows returns all Hyprland clients. Hyprland has no instance name, the
+// initial class is the closest equivalent.
+func (w *HyprlandIntegration) Windows() ([]Window, error) {
+	clients, err := w.clients()
+	if err != nil {
+		return nil, err
+	}
+	windows := make([]Window, len(clients))
+	for i, client := range clients {
+		windows[i] = Window{
+			ID:        client.Address,
+			Class:     client.Class,
+			Instance:  client.InitialClass,
+			Title:     client.Title,
+			PID:       client.PID,
+			Workspace: client.Workspace.Name,
+		}
+	}
+	return windows, nil
+}
+
+func (w *HyprlandIntegration) FindOrStartApplication(app config.App) (string, error) {
+	return findOrStart(app, w.Windows)
+}
+
+// SetModifier pins (Sticky) a window or makes it float. The pin dispatcher
+// toggles, so the current state is checked first. Hyprland has no
+// per-window layers and its fullscreen dispatcher only acts on the active
+// window, so Above and Fullscreen are unsupported.
+func (w *HyprlandIntegration) SetModifier(nodeID string, mod Modifier, on bool) error {
+	if mod != Sticky && mod != Floating {
+		return unsupportedModifier("hyprland", mod)
+	}
+	clients, err := w.clients()
+	if err != nil {
+		return err
+	}
+	for _, client := range clients {
+		if client.Address != nodeID {
+			continue
+		}
+		if mod == Floating {
+			return w.dispatch(fmt.Sprintf("%s address:%s", onOff(on, "setfloating", "settiled"), nodeID))
+		}
+		if client.Pinned == on {
+			return nil
+		}
+		return w.dispatch("pin address:" + nodeID)
+	}
+	return fmt.Errorf("no hyprland window with address %s", nodeID)
+}
+
+// Place floats the window and moves it onto the focused monitor
+func (w *HyprlandIntegration) Place(nodeID string, geometry config.Geometry) error {
+	var monitors []hyprlandMonitor
+	if err := w.requestJSON("monitors", &monitors); err != nil {
+		return err
+	}
+	for _, monitor := range monitors {
+		if !monitor.Focused {
+			continue
+		}
+		target, err := placeRect(geometry, monitor.area())
+		if err != nil {
+			return err
+		}
+		for _, args := range []string{
+			"setfloating address:" + nodeID,
+			fmt.Sprintf("resizewindowpixel exact %d %d,address:%s", target.Width, target.Height, nodeID),
+			fmt.Sprintf("movewindowpixel exact %d %d,address:%s", target.X, target.Y, nodeID),
+		} {
+			if err := w.dispatch(args); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("no focused hyprland monitor")
+}
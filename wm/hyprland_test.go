@@ -0,0 +1,249 @@
+package wm
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hellola/startorswitch/config"
+)
+
+const recordedHyprlandClients = `[
+  {"address": "0x55d1c0a1b2c0", "mapped": true, "hidden": false, "workspace": {"id": 1, "name": "1"},
+   "class": "kitty", "title": "~", "initialClass": "kitty", "initialTitle": "kitty", "pid": 5100},
+  {"address": "0x55d1c0a1b3d0", "mapped": true, "hidden": false, "workspace": {"id": 2, "name": "2"},
+   "class": "firefox", "title": "slack - Mozilla Firefox", "initialClass": "firefox", "initialTitle": "Mozilla Firefox", "pid": 5200},
+  {"address": "0x55d1c0a1b4e0", "mapped": true, "hidden": false, "workspace": {"id": -98, "name": "special:startorswitch"},
+   "class": "Slack", "title": "Slack | general", "initialClass": "Slack", "initialTitle": "Slack", "pid": 5300}
+]`
+
+// fakeHyprland answers requests on a fake Hyprland request socket
+type fakeHyprland struct {
+	mu         sync.Mutex
+	replies    map[string]string
+	dispatches []string
+}
+
+func newFakeHyprland(t *testing.T) *fakeHyprland {
+	t.Helper()
+	runtimeDir := t.TempDir()
+	signature := "v0.41.2_1719000000_1234567890"
+	t.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+	t.Setenv("HYPRLAND_INSTANCE_SIGNATURE", signature)
+
+	dir := filepath.Join(runtimeDir, "hypr", signature)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("unix", filepath.Join(dir, ".socket.sock"))
+	if err != nil {
+		t.Fatalf("Failed to listen on fake hyprland socket: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	h := &fakeHyprland{
+		replies: map[string]string{
+			"j/clients":         recordedHyprlandClients,
+			"j/activewindow":    `{"address": "0x55d1c0a1b2c0", "class": "kitty", "title": "~"}`,
+			"j/activeworkspace": `{"id": 1, "name": "1"}`,
+			"j/monitors":        `[{"name": "DP-1", "focused": true, "specialWorkspace": {"id": 0, "name": ""}}]`,
+		},
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			buf := make([]byte, 4096)
+			n, _ := conn.Read(buf)
+			req := string(buf[:n])
+
+			h.mu.Lock()
+			reply, ok := h.replies[req]
+			if strings.HasPrefix(req, "dispatch ") {
+				h.dispatches = append(h.dispatches, strings.TrimPrefix(req, "dispatch "))
+				reply, ok = "ok", true
+			}
+			h.mu.Unlock()
+			if !ok {
+				reply = "unknown request"
+			}
+			conn.Write([]byte(reply))
+			conn.Close()
+		}
+	}()
+	return h
+}
+
+func TestHyprlandIntegration_Queries(t *testing.T) {
+	newFakeHyprland(t)
+	w := NewHyprlandIntegration()
+
+	if got := w.GetFocusedID(); got != "0x55d1c0a1b2c0" {
+		t.Errorf("GetFocusedID() = %s, want 0x55d1c0a1b2c0", got)
+	}
+	if !w.StillAlive("0x55d1c0a1b4e0") {
+		t.Errorf("StillAlive() = false for a hidden client")
+	}
+	if w.StillAlive("0xdead") {
+		t.Errorf("StillAlive() = true for an unknown client")
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"slack", "0x55d1c0a1b4e0"},
+		{"kitty", "0x55d1c0a1b2c0"},
+		{"Mozilla", "0x55d1c0a1b3d0"},
+	}
+	for _, tt := range tests {
+		got, err := w.FindOrStartApplication(config.DefaultApp(tt.name))
+		if err != nil {
+			t.Fatalf("FindOrStartApplication(%s) error = %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("FindOrStartApplication(%s) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHyprlandIntegration_ShowHide(t *testing.T) {
+	h := newFakeHyprland(t)
+	w := NewHyprlandIntegration()
+
+	if err := w.Hide("0x55d1c0a1b2c0"); err != nil {
+		t.Fatalf("Hide() error = %v", err)
+	}
+	if err := w.Show("0x55d1c0a1b4e0"); err != nil {
+		t.Fatalf("Show() error = %v", err)
+	}
+
+	// Showing while the special workspace is open closes it again
+	h.mu.Lock()
+	h.replies["j/monitors"] = `[{"name": "DP-1", "focused": true, "specialWorkspace": {"id": -98, "name": "special:startorswitch"}}]`
+	h.mu.Unlock()
+	if err := w.Show("0x55d1c0a1b2c0"); err != nil {
+		t.Fatalf("Show() error = %v", err)
+	}
+
+	want := []string{
+		"movetoworkspacesilent special:startorswitch,address:0x55d1c0a1b2c0",
+		"movetoworkspacesilent name:1,address:0x55d1c0a1b4e0",
+		"focuswindow address:0x55d1c0a1b4e0",
+		"movetoworkspacesilent name:1,address:0x55d1c0a1b2c0",
+		"togglespecialworkspace startorswitch",
+		"focuswindow address:0x55d1c0a1b2c0",
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if strings.Join(h.dispatches, "\n") != strings.Join(want, "\n") {
+		t.Errorf("dispatches = %q, want %q", h.dispatches, want)
+	}
+}
+
+func TestHyprlandIntegration_ShowNamed(t *testing.T) {
+	h := newFakeHyprland(t)
+	h.mu.Lock()
+	h.replies["j/activeworkspace"] = `{"id": -1337, "name": "notes"}`
+	h.mu.Unlock()
+	w := NewHyprlandIntegration()
+
+	if err := w.Show("0x55d1c0a1b2c0"); err != nil {
+		t.Fatalf("Show() error = %v", err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if want := "movetoworkspacesilent name:notes,address:0x55d1c0a1b2c0"; len(h.dispatches) == 0 || h.dispatches[0] != want {
+		t.Errorf("dispatches = %q, want %q first", h.dispatches, want)
+	}
+}
+
+func TestHyprlandIntegration_Follow(t *testing.T) {
+	h := newFakeHyprland(t)
+	w := NewHyprlandIntegration()
+
+	if err := w.Follow("0x55d1c0a1b2c0", "3"); err != nil {
+		t.Fatalf("Follow() error = %v", err)
+	}
+
+	want := []string{
+		"movetoworkspace name:3,address:0x55d1c0a1b2c0",
+		"focuswindow address:0x55d1c0a1b2c0",
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if strings.Join(h.dispatches, "\n") != strings.Join(want, "\n") {
+		t.Errorf("dispatches = %q, want %q", h.dispatches, want)
+	}
+}
+
+func TestHyprlandIntegration_Modifiers(t *testing.T) {
+	h := newFakeHyprland(t)
+	w := NewHyprlandIntegration()
+	h.mu.Lock()
+	h.replies["j/clients"] = `[{"address": "0x55d1c0a1b2c0", "pinned": false}, {"address": "0x55d1c0a1b3d0", "pinned": true}]`
+	h.mu.Unlock()
+
+	if err := w.SetModifier("0x55d1c0a1b2c0", Sticky, true); err != nil {
+		t.Fatalf("SetModifier() error = %v", err)
+	}
+	// Already pinned, so pin is not toggled off again
+	if err := w.SetModifier("0x55d1c0a1b3d0", Sticky, true); err != nil {
+		t.Fatalf("SetModifier() error = %v", err)
+	}
+	if err := w.SetModifier("0x55d1c0a1b3d0", Floating, true); err != nil {
+		t.Fatalf("SetModifier() error = %v", err)
+	}
+	if err := w.SetModifier("0x55d1c0a1b3d0", Fullscreen, true); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("SetModifier(fullscreen) error = %v, want ErrUnsupported", err)
+	}
+	if err := w.SetModifier("0x1", Sticky, true); err == nil {
+		t.Errorf("SetModifier() of a missing window error = nil")
+	}
+
+	want := []string{"pin address:0x55d1c0a1b2c0", "setfloating address:0x55d1c0a1b3d0"}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if strings.Join(h.dispatches, "\n") != strings.Join(want, "\n") {
+		t.Errorf("dispatches = %q, want %q", h.dispatches, want)
+	}
+}
+
+func TestHyprlandIntegration_Place(t *testing.T) {
+	h := newFakeHyprland(t)
+	w := NewHyprlandIntegration()
+	h.mu.Lock()
+	h.replies["j/monitors"] = `[
+  {"name": "eDP-1", "focused": false, "x": 0, "y": 0, "width": 2880, "height": 1800, "scale": 2.0, "reserved": [0, 0, 0, 0]},
+  {"name": "DP-1", "focused": true, "x": 1440, "y": 0, "width": 3840, "height": 2160, "scale": 1.5, "reserved": [0, 40, 0, 0]}
+]`
+	h.mu.Unlock()
+
+	if err := w.Place("0x55d1c0a1b2c0", config.Geometry{Width: "100%", Height: "40%", Anchor: "top"}); err != nil {
+		t.Fatalf("Place() error = %v", err)
+	}
+	want := []string{
+		"setfloating address:0x55d1c0a1b2c0",
+		"resizewindowpixel exact 2560 560,address:0x55d1c0a1b2c0",
+		"movewindowpixel exact 1440 40,address:0x55d1c0a1b2c0",
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if strings.Join(h.dispatches, "\n") != strings.Join(want, "\n") {
+		t.Errorf("dispatches = %q, want %q", h.dispatches, want)
+	}
+}
+
+func TestHyprlandSocketPath_Missing(t *testing.T) {
+	t.Setenv("HYPRLAND_INSTANCE_SIGNATURE", "")
+	if _, err := hyprlandSocketPath(); err == nil {
+		t.Errorf("hyprlandSocketPath() error = nil without a signature")
+	}
+}
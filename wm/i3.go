@@ -2,95 +2,72 @@ package wm
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
-	"os/exec"
-	"strconv"
 	"strings"
-	"time"
+
+	"github.com/hellola/startorswitch/config"
+	"github.com/jezek/xgb/xproto"
 )
 
 // I3Integration implements WMIntegration for i3
-type I3Integration struct{}
+type I3Integration struct {
+	ipc *i3IPC
+	// x is used to look up window PIDs, which the i3 tree does not include
+	x *x11
+}
 
 // NewI3Integration creates a new i3 integration
 func NewI3Integration() *I3Integration {
 	log.Printf("Creating new i3 integration")
-	return &I3Integration{}
+	return &I3Integration{ipc: newI3IPC(i3SocketPath), x: &x11{}}
 }
 
 func (w *I3Integration) Show(nodeID string) error {
 	log.Printf("Showing i3 window with ID: %s", nodeID)
-	log.Printf("Executing i3 command: i3-msg [con_id=%s] scratchpad show", nodeID)
-	return exec.Command("i3-msg", fmt.Sprintf("[con_id=%s]", nodeID), "scratchpad", "show").Run()
+	return w.ipc.Command(fmt.Sprintf("[con_id=%s] scratchpad show", nodeID))
+}
+
+// Follow switches to workspace, where the window was before it went to the
+// scratchpad, and focuses the window there. Focusing a scratchpad window
+// shows it on the current workspace.
+func (w *I3Integration) Follow(nodeID, workspace string) error {
+	log.Printf("Following i3 window with ID %s to workspace %s", nodeID, workspace)
+	cmd := fmt.Sprintf("[con_id=%s] focus", nodeID)
+	if workspace != "" {
+		cmd = fmt.Sprintf("workspace %s; %s", i3Quote(workspace), cmd)
+	}
+	return w.ipc.Command(cmd)
+}
+
+// i3Quote quotes s as a command argument
+func i3Quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
 }
 
 func (w *I3Integration) Hide(nodeID string) error {
 	log.Printf("Hiding i3 window with ID: %s", nodeID)
-	log.Printf("Executing i3 command: i3-msg [con_id=%s] move scratchpad ", nodeID)
-	return exec.Command("i3-msg", fmt.Sprintf("[con_id=%s]", nodeID), "move", "scratchpad").Run()
-	// execCmd.Env = os.Environ()
-	// execCmd.Env = append(execCmd.Env, "DISPLAY=:0")
-	// output, err := execCmd.Run()
+	return w.ipc.Command(fmt.Sprintf("[con_id=%s] move scratchpad", nodeID))
 }
 
 func (w *I3Integration) StillAlive(nodeID string) bool {
 	log.Printf("Checking if i3 window %s is still alive", nodeID)
-	cmd := exec.Command("i3-msg", "-t", "get_tree")
-	output, err := cmd.Output()
+	tree, err := w.ipc.Tree()
 	if err != nil {
 		log.Printf("Error getting i3 tree: %v", err)
 		return false
 	}
 
-	var tree map[string]interface{}
-	if err := json.Unmarshal(output, &tree); err != nil {
-		log.Printf("Error unmarshaling i3 tree: %v", err)
-		return false
-	}
-
-	isAlive := w.findNodeInTree(tree, nodeID)
+	isAlive := tree.Find(func(n *i3Node) bool { return n.ConID() == nodeID }) != nil
 	log.Printf("Window %s alive status: %v", nodeID, isAlive)
 	return isAlive
 }
 
-func (w *I3Integration) findNodeInTree(node map[string]interface{}, nodeID string) bool {
-	if id, ok := node["id"].(float64); ok {
-		currentID := strconv.FormatFloat(id, 'f', -1, 64)
-		log.Printf("checking node current: %s, id: %s", currentID, nodeID)
-		if currentID == nodeID {
-			log.Printf("Found matching node ID in tree: %s", currentID)
-			return true
-		}
-	}
-
-	if nodes, ok := node["nodes"].([]interface{}); ok {
-		for _, n := range nodes {
-			if nodeMap, ok := n.(map[string]interface{}); ok {
-				if w.findNodeInTree(nodeMap, nodeID) {
-					return true
-				}
-			}
-		}
-	}
-	if nodes, ok := node["floating_nodes"].([]interface{}); ok {
-		for _, n := range nodes {
-			if nodeMap, ok := n.(map[string]interface{}); ok {
-				if w.findNodeInTree(nodeMap, nodeID) {
-					return true
-				}
-			}
-		}
-	}
-
-	return false
-}
-
 func (w *I3Integration) Focus(nodeID string) error {
 	log.Printf("Focusing i3 window with ID: %s", nodeID)
-	cmd := fmt.Sprintf("[con_id=%s] focus", nodeID)
-	log.Printf("Executing i3 command: %s", cmd)
-	return exec.Command("i3-msg", cmd).Run()
+	return w.ipc.Command(fmt.Sprintf("[con_id=%s] focus", nodeID))
 }
 
 func (w *I3Integration) IsFocused(nodeID string) bool {
@@ -103,166 +80,148 @@ func (w *I3Integration) IsFocused(nodeID string) bool {
 
 func (w *I3Integration) GetFocusedID() string {
 	log.Printf("Getting focused i3 window ID")
-	cmd := exec.Command("i3-msg", "-t", "get_tree")
-	output, err := cmd.Output()
+	tree, err := w.ipc.Tree()
 	if err != nil {
 		log.Printf("Error getting i3 tree: %v", err)
 		return ""
 	}
 
-	var tree map[string]interface{}
-	if err := json.Unmarshal(output, &tree); err != nil {
-		log.Printf("Error unmarshaling i3 tree: %v", err)
+	focused := tree.Find(func(n *i3Node) bool { return n.Focused })
+	if focused == nil {
 		return ""
 	}
-
-	focusedID := w.findFocusedNode(tree)
-	log.Printf("Found focused window ID: %s", focusedID)
-	return focusedID
+	log.Printf("Found focused window ID: %s", focused.ConID())
+	return focused.ConID()
 }
 
-func (w *I3Integration) findFocusedNode(node map[string]interface{}) string {
-	if focused, ok := node["focused"].(bool); ok && focused {
-		if id, ok := node["id"].(float64); ok {
-			return fmt.Sprintf("%d", int(id))
-		}
+// SetModifier switches sticky, floating or fullscreen on a container. i3
+// has no stacking layers, so Above is unsupported.
+func (w *I3Integration) SetModifier(nodeID string, mod Modifier, on bool) error {
+	switch mod {
+	case Sticky, Floating, Fullscreen:
+		return w.ipc.Command(fmt.Sprintf("[con_id=%s] %s %s", nodeID, mod, onOff(on, "enable", "disable")))
 	}
+	return unsupportedModifier("i3 and sway", mod)
+}
 
-	if nodes, ok := node["nodes"].([]interface{}); ok {
-		for _, n := range nodes {
-			if nodeMap, ok := n.(map[string]interface{}); ok {
-				if id := w.findFocusedNode(nodeMap); id != "" {
-					return id
-				}
-			}
-		}
+// SetTopPadding sets the top gap of the focused workspace, which needs i3
+// 4.22 (or i3-gaps) or sway
+func (w *I3Integration) SetTopPadding(pixels int) error {
+	return w.ipc.Command(fmt.Sprintf("gaps top current set %d", pixels))
+}
+
+// Place floats the container and moves it onto the focused workspace.
+// Positions are absolute, across all outputs.
+func (w *I3Integration) Place(nodeID string, geometry config.Geometry) error {
+	workspaces, err := w.ipc.Workspaces()
+	if err != nil {
+		return err
 	}
-	if nodes, ok := node["floating_nodes"].([]interface{}); ok {
-		for _, n := range nodes {
-			if nodeMap, ok := n.(map[string]interface{}); ok {
-				if id := w.findFocusedNode(nodeMap); id != "" {
-					return id
-				}
-			}
+	for _, workspace := range workspaces {
+		if !workspace.Focused {
+			continue
 		}
+		target, err := placeRect(geometry, workspace.Rect)
+		if err != nil {
+			return err
+		}
+		return w.ipc.Command(fmt.Sprintf("[con_id=%s] floating enable, resize set %d px %d px, move absolute position %d px %d px",
+			nodeID, target.Width, target.Height, target.X, target.Y))
 	}
-
-	return ""
+	return errors.New("no focused workspace")
 }
 
-func (w *I3Integration) findNodeIDByWindowID(node map[string]interface{}, windowID string) string {
-	if id, ok := node["id"].(float64); ok {
-		if window, ok := node["window"].(float64); ok {
-			currentWindowID := strconv.FormatFloat(window, 'f', -1, 64)
-
-			// log.Printf("--- s: %s w: %s id: %f", windowID, currentWindowID, id)
-			if currentWindowID == windowID {
-				return strconv.FormatFloat(id, 'f', -1, 64)
-			}
-		}
+// Watch follows window events. Windows moved to the scratchpad are reported
+// as hidden, focused windows and windows moved anywhere else as shown.
+func (w *I3Integration) Watch(handle func(Event)) error {
+	conn, err := w.ipc.Subscribe("window")
+	if err != nil {
+		return err
 	}
-
-	if nodes, ok := node["nodes"].([]interface{}); ok {
-		for _, n := range nodes {
-			if nodeMap, ok := n.(map[string]interface{}); ok {
-				if id := w.findNodeIDByWindowID(nodeMap, windowID); id != "" {
-					return id
-				}
-			}
+	defer conn.Close()
+	for {
+		msgType, payload, err := readI3Message(conn)
+		if errors.Is(err, io.EOF) {
+			return nil
 		}
-	}
-
-	if nodes, ok := node["floating_nodes"].([]interface{}); ok {
-		for _, n := range nodes {
-			if nodeMap, ok := n.(map[string]interface{}); ok {
-				if id := w.findNodeIDByWindowID(nodeMap, windowID); id != "" {
-					return id
-				}
-			}
+		if err != nil {
+			return err
+		}
+		if msgType != i3EventWindow {
+			continue
+		}
+		if event, ok := w.windowEvent(payload); ok {
+			handle(event)
 		}
 	}
-
-	return ""
 }
 
-func (w *I3Integration) FindOrStartApplication(name string) (string, error) {
-	log.Printf("Finding or starting application: %s", name)
-
-	// First try to find existing window
-	cmd := exec.Command("xdotool", "search", "--name", name)
-	output, err := cmd.Output()
-	if err == nil && len(output) > 0 {
-		ids := strings.Split(strings.TrimSpace(string(output)), "\n")
-		if len(ids) > 0 {
-			windowID := ids[0]
-			// Get i3 tree to find corresponding node ID
-			i3Cmd := exec.Command("i3-msg", "-t", "get_tree")
-			i3Output, err := i3Cmd.Output()
-			if err != nil {
-				log.Printf("Error getting i3 tree: %v", err)
-				return "", err
-			}
-
-			var tree map[string]interface{}
-			if err := json.Unmarshal(i3Output, &tree); err != nil {
-				log.Printf("Error unmarshaling i3 tree: %v", err)
-				return "", err
-			}
-
-			nodeID := w.findNodeIDByWindowID(tree, windowID)
-			if nodeID != "" {
-				log.Printf("Found existing window for %s with i3 node ID: %s", name, nodeID)
-				return nodeID, nil
-			}
+// windowEvent translates a window event payload into an Event
+func (w *I3Integration) windowEvent(payload []byte) (Event, bool) {
+	var raw i3WindowEvent
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		log.Printf("Error decoding i3 window event: %v", err)
+		return Event{}, false
+	}
+	nodeID := raw.Container.ConID()
+	switch raw.Change {
+	case "close":
+		return Event{Type: EventClosed, NodeID: nodeID}, true
+	case "focus":
+		return Event{Type: EventShown, NodeID: nodeID}, true
+	case "move":
+		// The event does not say where the window went, the tree does
+		tree, err := w.ipc.Tree()
+		if err != nil {
+			log.Printf("Error getting i3 tree: %v", err)
+			return Event{}, false
+		}
+		if inScratchpad(tree, nodeID) {
+			return Event{Type: EventHidden, NodeID: nodeID}, true
 		}
+		return Event{Type: EventShown, NodeID: nodeID}, true
 	}
+	return Event{}, false
+}
 
-	// Start the application
-	log.Printf("Starting application: %s", name)
-	cmd = exec.Command(name)
-	if err := cmd.Start(); err != nil {
-		log.Printf("Failed to start application %s: %v", name, err)
-		return "", fmt.Errorf("failed to start application: %v", err)
+// inScratchpad reports whether the container is on the scratchpad workspace
+func inScratchpad(tree *i3Node, nodeID string) bool {
+	scratch := tree.Find(func(n *i3Node) bool { return n.Type == "workspace" && n.Name == "__i3_scratch" })
+	if scratch == nil {
+		return false
 	}
+	return scratch.Find(func(n *i3Node) bool { return n.ConID() == nodeID }) != nil
+}
 
-	// Wait for window to appear
-	log.Printf("Waiting for window to appear...")
-	for i := 0; i < 10; i++ {
-		cmd := exec.Command("xdotool", "search", "--name", name)
-		output, err := cmd.Output()
-		if err == nil && len(output) > 0 {
-			ids := strings.Split(strings.TrimSpace(string(output)), "\n")
-			if len(ids) > 0 {
-
-				i3Cmd := exec.Command("i3-msg", "-t", "get_tree")
-				i3Output, err := i3Cmd.Output()
-				if err != nil {
-					log.Printf("Error getting i3 tree: %v", err)
-					continue
-				}
-
-				var tree map[string]interface{}
-				if err := json.Unmarshal(i3Output, &tree); err != nil {
-					log.Printf("Error unmarshaling i3 tree: %v", err)
-					continue
-				}
-
-				for _, windowID := range ids {
-
-					log.Printf("looking for node with window id: %s", windowID)
-					// Get i3 tree to find corresponding node ID
-					nodeID := w.findNodeIDByWindowID(tree, windowID)
-					if nodeID != "" {
-						log.Printf("Found window after starting %s with i3 node ID: %s", name, nodeID)
-						return nodeID, nil
-					}
-				}
+// Windows returns every X11 window container in the tree
+func (w *I3Integration) Windows() ([]Window, error) {
+	tree, err := w.ipc.Tree()
+	if err != nil {
+		log.Printf("Error getting i3 tree: %v", err)
+		return nil, err
+	}
+	hasX := w.x != nil && w.x.connect() == nil
+	var windows []Window
+	tree.Walk(func(n *i3Node, workspace string) {
+		if n.Window != nil {
+			window := Window{
+				ID:        n.ConID(),
+				Class:     n.WindowProperties.Class,
+				Instance:  n.WindowProperties.Instance,
+				Title:     n.WindowProperties.Title,
+				Role:      n.WindowProperties.Role,
+				Workspace: workspace,
+			}
+			if hasX {
+				pid, _ := w.x.cardinal(xproto.Window(*n.Window), "_NET_WM_PID")
+				window.PID = int(pid)
 			}
+			windows = append(windows, window)
 		}
-		log.Printf("Attempt %d/10: Window not found yet, waiting...", i+1)
-		time.Sleep(time.Second)
-	}
+	})
+	return windows, nil
+}
 
-	log.Printf("Failed to find window for %s after starting", name)
-	return "", fmt.Errorf("failed to find window after starting application")
+func (w *I3Integration) FindOrStartApplication(app config.App) (string, error) {
+	return findOrStart(app, w.Windows)
 }
@@ -0,0 +1,309 @@
+package wm
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// i3 IPC message types, see https://i3wm.org/docs/ipc.html
+const (
+	i3MsgRunCommand    uint32 = 0
+	i3MsgGetWorkspaces uint32 = 1
+	i3MsgSubscribe     uint32 = 2
+	i3MsgGetTree       uint32 = 4
+)
+
+// i3EventWindow is the message type of window events. Event types have the
+// highest bit set.
+const i3EventWindow uint32 = 0x80000003
+
+const i3Magic = "i3-ipc"
+
+// i3Node is a container in the tree returned by GET_TREE. AppID and PID are
+// only set by sway.
+type i3Node struct {
+	ID               int64              `json:"id"`
+	Name             string             `json:"name"`
+	Type             string             `json:"type"`
+	Focused          bool               `json:"focused"`
+	Window           *int64             `json:"window"`
+	WindowProperties i3WindowProperties `json:"window_properties"`
+	AppID            string             `json:"app_id"`
+	PID              int                `json:"pid"`
+	Nodes            []*i3Node          `json:"nodes"`
+	FloatingNodes    []*i3Node          `json:"floating_nodes"`
+}
+
+// i3WindowProperties holds the X11 properties of a window container
+type i3WindowProperties struct {
+	Class    string `json:"class"`
+	Instance string `json:"instance"`
+	Title    string `json:"title"`
+	Role     string `json:"window_role"`
+}
+
+// ConID returns the container ID in the form used by [con_id=...] criteria
+func (n *i3Node) ConID() string {
+	return strconv.FormatInt(n.ID, 10)
+}
+
+// Find returns the first node in the subtree, including n itself, for which
+// match returns true
+func (n *i3Node) Find(match func(*i3Node) bool) *i3Node {
+	if match(n) {
+		return n
+	}
+	for _, children := range [][]*i3Node{n.Nodes, n.FloatingNodes} {
+		for _, child := range children {
+			if found := child.Find(match); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// i3WindowEvent is the payload of a window event
+type i3WindowEvent struct {
+	Change    string `json:"change"`
+	Container i3Node `json:"container"`
+}
+
+// Walk calls fn for every node in the subtree, including n itself, along
+// with the name of the workspace containing it
+func (n *i3Node) Walk(fn func(n *i3Node, workspace string)) {
+	n.walk("", fn)
+}
+
+func (n *i3Node) walk(workspace string, fn func(*i3Node, string)) {
+	if n.Type == "workspace" {
+		workspace = n.Name
+	}
+	fn(n, workspace)
+	for _, children := range [][]*i3Node{n.Nodes, n.FloatingNodes} {
+		for _, child := range children {
+			child.walk(workspace, fn)
+		}
+	}
+}
+
+// i3CommandResult is one entry of a RUN_COMMAND reply
+type i3CommandResult struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error"`
+}
+
+// i3IPC is a client for the i3 IPC protocol. It dials the socket lazily and
+// keeps the connection open so a single invocation only connects once.
+type i3IPC struct {
+	mu         sync.Mutex
+	socketPath func() (string, error)
+	conn       net.Conn
+}
+
+// newI3IPC creates a client that connects to the socket returned by
+// socketPath on first use
+func newI3IPC(socketPath func() (string, error)) *i3IPC {
+	return &i3IPC{socketPath: socketPath}
+}
+
+// i3SocketPath returns the i3 IPC socket from $I3SOCK, falling back to
+// asking i3 itself
+func i3SocketPath() (string, error) {
+	if path := os.Getenv("I3SOCK"); path != "" {
+		return path, nil
+	}
+	output, err := exec.Command("i3", "--get-socketpath").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to find i3 socket: %v", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// Request sends a message and returns the payload of the reply. A broken
+// connection is redialed once before giving up, but a command that may
+// have reached i3 is never sent twice: commands such as "scratchpad show"
+// toggle, so only queries are retried after the message went out.
+func (c *i3IPC) Request(msgType uint32, payload []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	reply, sent, err := c.roundTrip(msgType, payload)
+	if err != nil && c.conn != nil && (!sent || msgType != i3MsgRunCommand) {
+		log.Printf("i3 IPC request failed, reconnecting: %v", err)
+		c.closeLocked()
+		reply, _, err = c.roundTrip(msgType, payload)
+	} else if err != nil {
+		c.closeLocked()
+	}
+	return reply, err
+}
+
+// roundTrip sends one message and reads its reply. sent reports whether
+// the message was written, so i3 may have acted on it.
+func (c *i3IPC) roundTrip(msgType uint32, payload []byte) (reply []byte, sent bool, err error) {
+	if c.conn == nil {
+		path, err := c.socketPath()
+		if err != nil {
+			return nil, false, err
+		}
+		conn, err := net.Dial("unix", path)
+		if err != nil {
+			return nil, false, err
+		}
+		c.conn = conn
+	}
+	if err := writeI3Message(c.conn, msgType, payload); err != nil {
+		return nil, false, err
+	}
+	replyType, reply, err := readI3Message(c.conn)
+	if err != nil {
+		return nil, true, err
+	}
+	if replyType != msgType {
+		return nil, true, fmt.Errorf("unexpected i3 reply type %d for request %d", replyType, msgType)
+	}
+	return reply, true, nil
+}
+
+// Close closes the underlying connection, if any
+func (c *i3IPC) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closeLocked()
+}
+
+func (c *i3IPC) closeLocked() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// Tree returns the current layout tree
+func (c *i3IPC) Tree() (*i3Node, error) {
+	reply, err := c.Request(i3MsgGetTree, nil)
+	if err != nil {
+		return nil, err
+	}
+	var tree i3Node
+	if err := json.Unmarshal(reply, &tree); err != nil {
+		return nil, err
+	}
+	return &tree, nil
+}
+
+// i3Workspace is one entry of the GET_WORKSPACES reply. Rect is the area
+// left to windows, without bars.
+type i3Workspace struct {
+	Name    string `json:"name"`
+	Focused bool   `json:"focused"`
+	Rect    Rect   `json:"rect"`
+}
+
+// Workspaces returns the visible and hidden workspaces
+func (c *i3IPC) Workspaces() ([]i3Workspace, error) {
+	reply, err := c.Request(i3MsgGetWorkspaces, nil)
+	if err != nil {
+		return nil, err
+	}
+	var workspaces []i3Workspace
+	if err := json.Unmarshal(reply, &workspaces); err != nil {
+		return nil, err
+	}
+	return workspaces, nil
+}
+
+// Command runs an i3 command and reports the first failure, if any
+func (c *i3IPC) Command(cmd string) error {
+	log.Printf("Executing i3 command: %s", cmd)
+	reply, err := c.Request(i3MsgRunCommand, []byte(cmd))
+	if err != nil {
+		return err
+	}
+	var results []i3CommandResult
+	if err := json.Unmarshal(reply, &results); err != nil {
+		return err
+	}
+	for _, result := range results {
+		if !result.Success {
+			return fmt.Errorf("i3 command %q failed: %s", cmd, result.Error)
+		}
+	}
+	return nil
+}
+
+// Subscribe opens a connection subscribed to events, such as "window".
+// Events arrive unsolicited, so they get their own connection instead of
+// sharing the one used for requests.
+func (c *i3IPC) Subscribe(events ...string) (net.Conn, error) {
+	path, err := c.socketPath()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(events)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := writeI3Message(conn, i3MsgSubscribe, payload); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	replyType, reply, err := readI3Message(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	var result i3CommandResult
+	if replyType != i3MsgSubscribe || json.Unmarshal(reply, &result) != nil || !result.Success {
+		conn.Close()
+		return nil, fmt.Errorf("failed to subscribe to i3 events %v: %s", events, reply)
+	}
+	return conn, nil
+}
+
+// writeI3Message and readI3Message frame messages in the native byte order
+// of the machine, as the i3 IPC protocol specifies
+func writeI3Message(w io.Writer, msgType uint32, payload []byte) error {
+	msg := make([]byte, len(i3Magic)+8+len(payload))
+	copy(msg, i3Magic)
+	binary.NativeEndian.PutUint32(msg[len(i3Magic):], uint32(len(payload)))
+	binary.NativeEndian.PutUint32(msg[len(i3Magic)+4:], msgType)
+	copy(msg[len(i3Magic)+8:], payload)
+	_, err := w.Write(msg)
+	return err
+}
+
+func readI3Message(r io.Reader) (uint32, []byte, error) {
+	header := make([]byte, len(i3Magic)+8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	if string(header[:len(i3Magic)]) != i3Magic {
+		return 0, nil, errors.New("invalid i3 IPC magic")
+	}
+	length := binary.NativeEndian.Uint32(header[len(i3Magic):])
+	msgType := binary.NativeEndian.Uint32(header[len(i3Magic)+4:])
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return msgType, payload, nil
+}
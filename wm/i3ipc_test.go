@@ -0,0 +1,386 @@
+package wm
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hellola/startorswitch/config"
+)
+
+// recordedI3Tree is a trimmed GET_TREE reply from an i3 session with one
+// tiled terminal, one focused floating window and an empty scratchpad
+const recordedI3Tree = `{
+  "id": 1, "type": "root", "name": "root", "window": null,
+  "nodes": [
+    {"id": 2, "type": "output", "name": "__i3", "window": null, "nodes": [
+      {"id": 3, "type": "con", "name": "content", "window": null, "nodes": [
+        {"id": 4, "type": "workspace", "name": "__i3_scratch", "window": null, "nodes": [], "floating_nodes": []}
+      ]}
+    ]},
+    {"id": 10, "type": "output", "name": "HDMI-1", "window": null, "nodes": [
+      {"id": 11, "type": "con", "name": "content", "window": null, "nodes": [
+        {"id": 12, "type": "workspace", "name": "1", "window": null,
+          "nodes": [
+            {"id": 94001, "type": "con", "name": "htop", "window": 2097154, "focused": false,
+              "window_properties": {"class": "kitty", "instance": "kitty", "title": "htop"}, "nodes": []}
+          ],
+          "floating_nodes": [
+            {"id": 94002, "type": "floating_con", "window": null, "nodes": [
+              {"id": 94003, "type": "con", "name": "notes", "window": 2097160, "focused": true,
+                "window_properties": {"class": "Obsidian", "instance": "obsidian", "title": "notes"}, "nodes": []}
+            ]}
+          ]}
+      ]}
+    ]}
+  ]
+}`
+
+// fakeI3Server serves the i3 IPC protocol on a unix socket, replying to
+// GET_TREE and GET_WORKSPACES with fixed replies and recording RUN_COMMAND
+// payloads. Subscribers receive the recorded window events before the
+// connection is closed.
+type fakeI3Server struct {
+	path string
+
+	mu         sync.Mutex
+	tree       string
+	workspaces string
+	events     []string
+	commands   []string
+	accepts    int
+	failNext   string
+	// dropNext closes the connection instead of replying to the next
+	// command, as if i3 restarted after running it
+	dropNext bool
+}
+
+func newFakeI3Server(t *testing.T, tree string) *fakeI3Server {
+	t.Helper()
+	s := &fakeI3Server{
+		path: filepath.Join(t.TempDir(), "i3.sock"),
+		tree: tree,
+	}
+	listener, err := net.Listen("unix", s.path)
+	if err != nil {
+		t.Fatalf("Failed to listen on fake i3 socket: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.accepts++
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeI3Server) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		msgType, payload, err := readI3Message(conn)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		var reply string
+		switch msgType {
+		case i3MsgGetTree:
+			reply = s.tree
+		case i3MsgGetWorkspaces:
+			reply = s.workspaces
+		case i3MsgRunCommand:
+			s.commands = append(s.commands, string(payload))
+			if s.dropNext {
+				s.dropNext = false
+				s.mu.Unlock()
+				return
+			}
+			reply = `[{"success":true}]`
+			if s.failNext != "" {
+				reply = `[{"success":false,"error":"` + s.failNext + `"}]`
+				s.failNext = ""
+			}
+		case i3MsgSubscribe:
+			reply = `{"success":true}`
+		}
+		events := s.events
+		s.mu.Unlock()
+		if err := writeI3Message(conn, msgType, []byte(reply)); err != nil {
+			return
+		}
+		if msgType == i3MsgSubscribe {
+			for _, event := range events {
+				if err := writeI3Message(conn, i3EventWindow, []byte(event)); err != nil {
+					return
+				}
+			}
+			return
+		}
+	}
+}
+
+func (s *fakeI3Server) integration() *I3Integration {
+	return &I3Integration{ipc: newI3IPC(func() (string, error) { return s.path, nil })}
+}
+
+func TestI3Integration_GetFocusedID(t *testing.T) {
+	server := newFakeI3Server(t, recordedI3Tree)
+	w := server.integration()
+
+	if got := w.GetFocusedID(); got != "94003" {
+		t.Errorf("GetFocusedID() = %s, want 94003", got)
+	}
+	if !w.IsFocused("94003") {
+		t.Errorf("IsFocused(94003) = false, want true")
+	}
+}
+
+func TestI3Integration_StillAlive(t *testing.T) {
+	server := newFakeI3Server(t, recordedI3Tree)
+	w := server.integration()
+
+	tests := []struct {
+		nodeID string
+		want   bool
+	}{
+		{"94001", true},
+		{"94003", true},
+		{"12345", false},
+	}
+	for _, tt := range tests {
+		if got := w.StillAlive(tt.nodeID); got != tt.want {
+			t.Errorf("StillAlive(%s) = %v, want %v", tt.nodeID, got, tt.want)
+		}
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.accepts != 1 {
+		t.Errorf("connections = %d, want 1", server.accepts)
+	}
+}
+
+func TestI3Integration_Windows(t *testing.T) {
+	server := newFakeI3Server(t, recordedI3Tree)
+	w := server.integration()
+
+	windows, err := w.Windows()
+	if err != nil {
+		t.Fatalf("Windows() error = %v", err)
+	}
+	if len(windows) != 2 {
+		t.Fatalf("Windows() = %v, want 2 windows", windows)
+	}
+	matcher, err := NewMatcher(config.App{Name: "notes", Match: config.Match{Instance: "obsidian"}})
+	if err != nil {
+		t.Fatalf("NewMatcher() error = %v", err)
+	}
+	if got := matcher.Find(windows); got != "94003" {
+		t.Errorf("Find() = %s, want 94003", got)
+	}
+}
+
+func TestI3Integration_Commands(t *testing.T) {
+	server := newFakeI3Server(t, recordedI3Tree)
+	w := server.integration()
+
+	if err := w.Hide("94001"); err != nil {
+		t.Fatalf("Hide() error = %v", err)
+	}
+	if err := w.Show("94001"); err != nil {
+		t.Fatalf("Show() error = %v", err)
+	}
+	if err := w.Focus("94001"); err != nil {
+		t.Fatalf("Focus() error = %v", err)
+	}
+	if err := w.Follow("94001", `my "ws"`); err != nil {
+		t.Fatalf("Follow() error = %v", err)
+	}
+
+	server.mu.Lock()
+	server.failNext = "No window matches given criteria"
+	server.mu.Unlock()
+	if err := w.Focus("1"); err == nil {
+		t.Errorf("Focus() error = nil, want command failure")
+	}
+
+	want := []string{
+		"[con_id=94001] move scratchpad",
+		"[con_id=94001] scratchpad show",
+		"[con_id=94001] focus",
+		`workspace "my \"ws\""; [con_id=94001] focus`,
+		"[con_id=1] focus",
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.commands) != len(want) {
+		t.Fatalf("commands = %q, want %q", server.commands, want)
+	}
+	for i := range want {
+		if server.commands[i] != want[i] {
+			t.Errorf("command %d = %q, want %q", i, server.commands[i], want[i])
+		}
+	}
+}
+
+func TestI3Integration_Modifiers(t *testing.T) {
+	server := newFakeI3Server(t, recordedI3Tree)
+	w := server.integration()
+
+	if err := w.SetModifier("94001", Sticky, true); err != nil {
+		t.Fatalf("SetModifier() error = %v", err)
+	}
+	if err := w.SetModifier("94001", Floating, false); err != nil {
+		t.Fatalf("SetModifier() error = %v", err)
+	}
+	if err := w.SetModifier("94001", Above, true); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("SetModifier(above) error = %v, want ErrUnsupported", err)
+	}
+	if err := w.SetTopPadding(30); err != nil {
+		t.Fatalf("SetTopPadding() error = %v", err)
+	}
+
+	want := []string{
+		"[con_id=94001] sticky enable",
+		"[con_id=94001] floating disable",
+		"gaps top current set 30",
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if strings.Join(server.commands, "\n") != strings.Join(want, "\n") {
+		t.Errorf("commands = %q, want %q", server.commands, want)
+	}
+}
+
+func TestI3Integration_Place(t *testing.T) {
+	server := newFakeI3Server(t, recordedI3Tree)
+	server.workspaces = `[
+  {"num": 1, "name": "1", "visible": true, "focused": false, "output": "eDP-1",
+   "rect": {"x": 0, "y": 0, "width": 1920, "height": 1080}},
+  {"num": 2, "name": "2", "visible": true, "focused": true, "output": "HDMI-1",
+   "rect": {"x": 1920, "y": 22, "width": 2560, "height": 1418}}
+]`
+	w := server.integration()
+
+	if err := w.Place("94001", config.Geometry{Width: "100%", Height: "50%", Anchor: "top"}); err != nil {
+		t.Fatalf("Place() error = %v", err)
+	}
+	want := "[con_id=94001] floating enable, resize set 2560 px 709 px, move absolute position 1920 px 22 px"
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.commands) != 1 || server.commands[0] != want {
+		t.Errorf("commands = %q, want %q", server.commands, want)
+	}
+}
+
+func TestI3IPC_Reconnect(t *testing.T) {
+	server := newFakeI3Server(t, recordedI3Tree)
+	w := server.integration()
+
+	if _, err := w.ipc.Tree(); err != nil {
+		t.Fatalf("Tree() error = %v", err)
+	}
+	// Simulate i3 restarting and dropping the connection
+	w.ipc.conn.Close()
+	if _, err := w.ipc.Tree(); err != nil {
+		t.Fatalf("Tree() after disconnect error = %v", err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.accepts != 2 {
+		t.Errorf("connections = %d, want 2", server.accepts)
+	}
+}
+
+func TestI3IPC_CommandNotResent(t *testing.T) {
+	server := newFakeI3Server(t, recordedI3Tree)
+	w := server.integration()
+	server.mu.Lock()
+	server.dropNext = true
+	server.mu.Unlock()
+
+	if err := w.ipc.Command("[con_id=94001] scratchpad show"); err == nil {
+		t.Errorf("Command() without a reply error = nil")
+	}
+	server.mu.Lock()
+	if len(server.commands) != 1 {
+		t.Errorf("commands = %q, want the toggle sent once", server.commands)
+	}
+	server.mu.Unlock()
+
+	// The next request starts over on a fresh connection
+	if _, err := w.ipc.Tree(); err != nil {
+		t.Fatalf("Tree() after a dropped command error = %v", err)
+	}
+}
+
+// recordedI3ScratchTree is recordedI3Tree after moving the htop terminal to
+// the scratchpad
+const recordedI3ScratchTree = `{
+  "id": 1, "type": "root", "name": "root", "window": null,
+  "nodes": [
+    {"id": 2, "type": "output", "name": "__i3", "window": null, "nodes": [
+      {"id": 3, "type": "con", "name": "content", "window": null, "nodes": [
+        {"id": 4, "type": "workspace", "name": "__i3_scratch", "window": null, "nodes": [],
+          "floating_nodes": [
+            {"id": 94004, "type": "floating_con", "window": null, "nodes": [
+              {"id": 94001, "type": "con", "name": "htop", "window": 2097154, "focused": false,
+                "window_properties": {"class": "kitty", "instance": "kitty", "title": "htop"}, "nodes": []}
+            ]}
+          ]}
+      ]}
+    ]},
+    {"id": 10, "type": "output", "name": "HDMI-1", "window": null, "nodes": [
+      {"id": 11, "type": "con", "name": "content", "window": null, "nodes": [
+        {"id": 12, "type": "workspace", "name": "1", "window": null, "nodes": [],
+          "floating_nodes": [
+            {"id": 94002, "type": "floating_con", "window": null, "nodes": [
+              {"id": 94003, "type": "con", "name": "notes", "window": 2097160, "focused": true,
+                "window_properties": {"class": "Obsidian", "instance": "obsidian", "title": "notes"}, "nodes": []}
+            ]}
+          ]}
+      ]}
+    ]}
+  ]
+}`
+
+func TestI3Integration_Watch(t *testing.T) {
+	server := newFakeI3Server(t, recordedI3ScratchTree)
+	server.mu.Lock()
+	server.events = []string{
+		`{"change":"move","container":{"id":94001,"type":"con","window":2097154}}`,
+		`{"change":"focus","container":{"id":94003,"type":"con","window":2097160}}`,
+		`{"change":"title","container":{"id":94003,"type":"con","window":2097160}}`,
+		`{"change":"move","container":{"id":94003,"type":"con","window":2097160}}`,
+		`{"change":"close","container":{"id":94003,"type":"con","window":2097160}}`,
+	}
+	server.mu.Unlock()
+	w := server.integration()
+
+	var events []Event
+	if err := w.Watch(func(e Event) { events = append(events, e) }); err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	want := []Event{
+		{Type: EventHidden, NodeID: "94001"},
+		{Type: EventShown, NodeID: "94003"},
+		{Type: EventShown, NodeID: "94003"},
+		{Type: EventClosed, NodeID: "94003"},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+}
@@ -1,5 +1,7 @@
 package wm
 
+import "github.com/hellola/startorswitch/config"
+
 // WMIntegration defines the interface for window manager operations
 type WMIntegration interface {
 	Show(nodeID string) error
@@ -8,5 +10,27 @@ type WMIntegration interface {
 	Focus(nodeID string) error
 	IsFocused(nodeID string) bool
 	GetFocusedID() string
-	FindOrStartApplication(name string) (string, error)
+	FindOrStartApplication(app config.App) (string, error)
+}
+
+// WindowLister is implemented by backends that can enumerate the windows
+// they manage
+type WindowLister interface {
+	Windows() ([]Window, error)
+}
+
+// Follower is implemented by backends that can show a window on the desktop
+// it lives on and switch there, the alternative to Show bringing it to the
+// focused desktop. workspace is where the window was before it was hidden,
+// needed by backends that hide windows off their workspace; it may be
+// empty if that isn't known.
+type Follower interface {
+	Follow(nodeID, workspace string) error
+}
+
+// VisibilityReporter is implemented by backends that can tell whether the
+// window manager has hidden a window, so the state catches up with windows
+// minimized or restored by other means
+type VisibilityReporter interface {
+	IsHidden(nodeID string) (bool, error)
 }
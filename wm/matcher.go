@@ -0,0 +1,204 @@
+package wm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hellola/startorswitch/config"
+)
+
+// Window describes a window as seen by a backend
+type Window struct {
+	ID       string
+	Class    string
+	Instance string
+	Title    string
+	Role     string
+	PID      int
+	// Workspace is the name of the workspace or desktop the window is on,
+	// if the backend knows it
+	Workspace string
+}
+
+// Criterion names a window property a Matcher selects on
+type Criterion string
+
+const (
+	CriterionPID      Criterion = "pid"
+	CriterionClass    Criterion = "class"
+	CriterionInstance Criterion = "instance"
+	CriterionRole     Criterion = "role"
+	CriterionTitle    Criterion = "title"
+)
+
+// DefaultPrecedence is the order criteria are applied in when an app does
+// not configure one
+var DefaultPrecedence = []Criterion{CriterionPID, CriterionClass, CriterionInstance, CriterionRole, CriterionTitle}
+
+// Matcher picks the window belonging to an application.
+//
+// Criteria are applied in precedence order, each narrowing the candidate
+// windows. Before the owning process is known every configured rule is a
+// requirement. Once windows owned by the launched process tree have been
+// selected, the remaining criteria only break ties between them, so a freshly
+// started window is accepted even if, say, its title has not been set yet.
+// Criteria missing from the precedence list are ignored.
+type Matcher struct {
+	app        config.App
+	title      *regexp.Regexp
+	precedence []Criterion
+	pids       map[int]bool
+}
+
+// NewMatcher creates a Matcher for app, validating its rules
+func NewMatcher(app config.App) (*Matcher, error) {
+	m := &Matcher{app: app, precedence: DefaultPrecedence}
+	if app.Match.Title != "" {
+		title, err := regexp.Compile(app.Match.Title)
+		if err != nil {
+			return nil, fmt.Errorf("invalid title pattern for %s: %v", app.Name, err)
+		}
+		m.title = title
+	}
+	if len(app.MatchPrecedence) > 0 {
+		m.precedence = make([]Criterion, len(app.MatchPrecedence))
+		for i, name := range app.MatchPrecedence {
+			c := Criterion(name)
+			switch c {
+			case CriterionPID, CriterionClass, CriterionInstance, CriterionRole, CriterionTitle:
+				m.precedence[i] = c
+			default:
+				return nil, fmt.Errorf("unknown match criterion for %s: %s", app.Name, name)
+			}
+		}
+	}
+	return m, nil
+}
+
+// SetProcessTree restricts the pid criterion to root and its descendants
+func (m *Matcher) SetProcessTree(root int) {
+	m.pids = processTree(root)
+}
+
+// Find returns the ID of the best matching window, or "" if none matches
+func (m *Matcher) Find(windows []Window) string {
+	candidates := windows
+	owned := false
+	for _, c := range m.precedence {
+		keep, configured := m.criterion(c)
+		if !configured {
+			continue
+		}
+		narrowed := filterWindows(candidates, keep)
+		switch {
+		case len(narrowed) > 0:
+			candidates = narrowed
+			if c == CriterionPID {
+				owned = true
+			}
+		case c == CriterionPID || owned:
+			// The process tree and anything after it are preferences
+		default:
+			return ""
+		}
+	}
+
+	if m.app.Match.IsZero() && !owned {
+		return m.findByName(candidates)
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	return candidates[0].ID
+}
+
+// findByName implements the lookup for apps without match rules: class or
+// instance equal to the app name, falling back to a title containing it
+func (m *Matcher) findByName(windows []Window) string {
+	for _, w := range windows {
+		if strings.EqualFold(w.Class, m.app.Name) || strings.EqualFold(w.Instance, m.app.Name) {
+			return w.ID
+		}
+	}
+	for _, w := range windows {
+		if strings.Contains(w.Title, m.app.Name) {
+			return w.ID
+		}
+	}
+	return ""
+}
+
+// criterion returns the predicate for c and whether the app configures it
+func (m *Matcher) criterion(c Criterion) (func(Window) bool, bool) {
+	rules := m.app.Match
+	switch c {
+	case CriterionPID:
+		return func(w Window) bool { return m.pids[w.PID] }, len(m.pids) > 0
+	case CriterionClass:
+		return func(w Window) bool { return strings.EqualFold(rules.Class, w.Class) }, rules.Class != ""
+	case CriterionInstance:
+		return func(w Window) bool { return strings.EqualFold(rules.Instance, w.Instance) }, rules.Instance != ""
+	case CriterionRole:
+		return func(w Window) bool { return strings.EqualFold(rules.Role, w.Role) }, rules.Role != ""
+	case CriterionTitle:
+		return func(w Window) bool { return m.title.MatchString(w.Title) }, m.title != nil
+	}
+	return nil, false
+}
+
+func filterWindows(windows []Window, keep func(Window) bool) []Window {
+	var kept []Window
+	for _, w := range windows {
+		if keep(w) {
+			kept = append(kept, w)
+		}
+	}
+	return kept
+}
+
+// processTree returns root and all of its descendants according to /proc
+func processTree(root int) map[int]bool {
+	parents := make(map[int]int)
+	stats, _ := filepath.Glob("/proc/[0-9]*/stat")
+	for _, path := range stats {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		// The command name may contain spaces, the fields after it don't
+		stat := string(data)
+		end := strings.LastIndexByte(stat, ')')
+		if end < 0 {
+			continue
+		}
+		pid, err := strconv.Atoi(strings.Fields(stat[:end])[0])
+		if err != nil {
+			continue
+		}
+		fields := strings.Fields(stat[end+1:])
+		if len(fields) < 2 {
+			continue
+		}
+		ppid, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		parents[pid] = ppid
+	}
+
+	tree := map[int]bool{root: true}
+	for changed := true; changed; {
+		changed = false
+		for pid, ppid := range parents {
+			if tree[ppid] && !tree[pid] {
+				tree[pid] = true
+				changed = true
+			}
+		}
+	}
+	return tree
+}
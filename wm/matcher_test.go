@@ -0,0 +1,148 @@
+package wm
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/hellola/startorswitch/config"
+)
+
+func TestMatcher_Find(t *testing.T) {
+	windows := []Window{
+		{ID: "1", Class: "firefox", Instance: "Navigator", Title: "slack - Mozilla Firefox", Role: "browser", PID: 100},
+		{ID: "2", Class: "kitty", Instance: "kitty", Title: "~", PID: 200},
+		{ID: "3", Class: "kitty", Instance: "scratch-term", Title: "htop", PID: 300},
+		{ID: "4", Class: "Slack", Instance: "slack", Title: "Slack | general", PID: 400},
+		{ID: "5", Class: "Slack", Instance: "slack", Title: "Slack - Huddle", PID: 401},
+	}
+
+	tests := []struct {
+		name    string
+		app     config.App
+		pids    []int
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "default matches class before title",
+			app:  config.DefaultApp("slack"),
+			want: "4",
+		},
+		{
+			name: "default falls back to title",
+			app:  config.DefaultApp("Mozilla"),
+			want: "1",
+		},
+		{
+			name: "default prefers the launched process over a title hit",
+			app:  config.DefaultApp("Mozilla"),
+			pids: []int{300},
+			want: "3",
+		},
+		{
+			name: "class and instance must both match",
+			app:  config.App{Name: "term", Match: config.Match{Class: "kitty", Instance: "scratch-term"}},
+			want: "3",
+		},
+		{
+			name: "title is a regular expression",
+			app:  config.App{Name: "top", Match: config.Match{Title: "^h.op$"}},
+			want: "3",
+		},
+		{
+			name: "role",
+			app:  config.App{Name: "web", Match: config.Match{Role: "browser"}},
+			want: "1",
+		},
+		{
+			name: "configured rules disable the name fallback",
+			app:  config.App{Name: "kitty", Match: config.Match{Instance: "dropdown"}},
+			want: "",
+		},
+		{
+			name: "launched process picks among matching windows",
+			app:  config.App{Name: "slack", Match: config.Match{Class: "Slack"}},
+			pids: []int{401},
+			want: "5",
+		},
+		{
+			name: "rules after pid only break ties",
+			app:  config.App{Name: "slack", Match: config.Match{Class: "Slack", Title: "general"}},
+			pids: []int{401},
+			want: "5",
+		},
+		{
+			name: "rules before pid are still required",
+			app: config.App{Name: "slack", Match: config.Match{Class: "Slack"},
+				MatchPrecedence: []string{"class", "pid"}},
+			pids: []int{300},
+			want: "4",
+		},
+		{
+			name: "launched process without a window falls back to the rules",
+			app:  config.App{Name: "slack", Match: config.Match{Class: "Slack", Title: "Huddle"}},
+			pids: []int{999},
+			want: "5",
+		},
+		{
+			name: "criteria left out of the precedence are ignored",
+			app: config.App{Name: "term", Match: config.Match{Class: "kitty", Title: "htop"},
+				MatchPrecedence: []string{"class"}},
+			want: "2",
+		},
+		{
+			name:    "invalid title pattern",
+			app:     config.App{Name: "bad", Match: config.Match{Title: "("}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown criterion",
+			app:     config.App{Name: "bad", MatchPrecedence: []string{"colour"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matcher, err := NewMatcher(tt.app)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewMatcher() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(tt.pids) > 0 {
+				matcher.pids = make(map[int]bool)
+				for _, pid := range tt.pids {
+					matcher.pids[pid] = true
+				}
+			}
+			if got := matcher.Find(windows); got != tt.want {
+				t.Errorf("Find() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessTree(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("cannot start sleep: %v", err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	tree := processTree(os.Getpid())
+	if !tree[os.Getpid()] {
+		t.Errorf("processTree() does not include the root")
+	}
+	if !tree[cmd.Process.Pid] {
+		t.Errorf("processTree() does not include child %d", cmd.Process.Pid)
+	}
+	if tree[1] {
+		t.Errorf("processTree() includes init")
+	}
+}
@@ -0,0 +1,62 @@
+package wm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Modifier is a window property that can be switched on or off
+type Modifier string
+
+const (
+	// Sticky windows stay visible on every workspace
+	Sticky Modifier = "sticky"
+	// Floating windows are taken out of the tiling layout
+	Floating Modifier = "floating"
+	// Above windows are stacked above normal windows
+	Above Modifier = "above"
+	// Fullscreen windows cover their whole monitor
+	Fullscreen Modifier = "fullscreen"
+)
+
+// Modifiers lists every Modifier
+var Modifiers = []Modifier{Sticky, Floating, Above, Fullscreen}
+
+// ErrUnsupported is returned for operations a window manager can't perform
+var ErrUnsupported = errors.New("not supported by the window manager")
+
+// Modifiable is implemented by backends that can switch window modifiers.
+// Modifiers a backend has no equivalent for fail with ErrUnsupported.
+type Modifiable interface {
+	SetModifier(nodeID string, mod Modifier, on bool) error
+}
+
+// Padder is implemented by backends that can reserve space at the top of
+// the focused monitor, e.g. to make room for a drop-down window
+type Padder interface {
+	SetTopPadding(pixels int) error
+}
+
+// ParseModifier returns the Modifier called name
+func ParseModifier(name string) (Modifier, error) {
+	for _, mod := range Modifiers {
+		if string(mod) == name {
+			return mod, nil
+		}
+	}
+	return "", fmt.Errorf("unknown modifier: %s", name)
+}
+
+// unsupportedModifier reports a modifier the named backend has no
+// equivalent for
+func unsupportedModifier(backend string, mod Modifier) error {
+	return fmt.Errorf("%s on %s: %w", mod, backend, ErrUnsupported)
+}
+
+// onOff formats on the way bspwm flags and i3 commands expect it
+func onOff(on bool, yes, no string) string {
+	if on {
+		return yes
+	}
+	return no
+}
@@ -0,0 +1,71 @@
+package wm
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/hellola/startorswitch/config"
+)
+
+// SwayIntegration implements WMIntegration for sway. Sway speaks the i3 IPC
+// protocol and understands the same scratchpad commands, so only window
+// lookup differs: Wayland windows have an app_id instead of an X11 class.
+type SwayIntegration struct {
+	I3Integration
+}
+
+// NewSwayIntegration creates a new sway integration
+func NewSwayIntegration() *SwayIntegration {
+	log.Printf("Creating new sway integration")
+	return &SwayIntegration{I3Integration{ipc: newI3IPC(swaySocketPath)}}
+}
+
+// swaySocketPath returns the sway IPC socket from $SWAYSOCK, falling back to
+// asking sway itself
+func swaySocketPath() (string, error) {
+	if path := os.Getenv("SWAYSOCK"); path != "" {
+		return path, nil
+	}
+	output, err := exec.Command("sway", "--get-socketpath").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to find sway socket: %v", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// Windows returns every view in the tree. Native Wayland windows are
+// matched by app_id in place of the X11 class.
+func (w *SwayIntegration) Windows() ([]Window, error) {
+	tree, err := w.ipc.Tree()
+	if err != nil {
+		log.Printf("Error getting sway tree: %v", err)
+		return nil, err
+	}
+	var windows []Window
+	tree.Walk(func(n *i3Node, workspace string) {
+		if n.PID == 0 {
+			return
+		}
+		class := n.AppID
+		if class == "" {
+			class = n.WindowProperties.Class
+		}
+		windows = append(windows, Window{
+			ID:        n.ConID(),
+			Class:     class,
+			Instance:  n.WindowProperties.Instance,
+			Title:     n.Name,
+			Role:      n.WindowProperties.Role,
+			PID:       n.PID,
+			Workspace: workspace,
+		})
+	})
+	return windows, nil
+}
+
+func (w *SwayIntegration) FindOrStartApplication(app config.App) (string, error) {
+	return findOrStart(app, w.Windows)
+}
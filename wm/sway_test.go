@@ -0,0 +1,90 @@
+package wm
+
+import (
+	"testing"
+
+	"github.com/hellola/startorswitch/config"
+)
+
+// recordedSwayTree is a trimmed GET_TREE reply from sway with a native
+// Wayland terminal, an Xwayland window and a hidden scratchpad window
+const recordedSwayTree = `{
+  "id": 1, "type": "root", "name": "root",
+  "nodes": [
+    {"id": 2, "type": "output", "name": "__i3", "nodes": [
+      {"id": 3, "type": "workspace", "name": "__i3_scratch", "nodes": [],
+        "floating_nodes": [
+          {"id": 7, "type": "floating_con", "name": "scratch notes", "app_id": "org.gnome.TextEditor", "pid": 4411, "nodes": []}
+        ]}
+    ]},
+    {"id": 4, "type": "output", "name": "eDP-1", "nodes": [
+      {"id": 5, "type": "workspace", "name": "1",
+        "nodes": [
+          {"id": 8, "type": "con", "name": "~ - fish", "app_id": "foot", "pid": 4100, "focused": true, "nodes": []},
+          {"id": 9, "type": "con", "name": "Slack | general", "app_id": null, "pid": 4200, "window": 6291459,
+            "window_properties": {"class": "Slack", "instance": "slack", "title": "Slack | general"}, "nodes": []}
+        ],
+        "floating_nodes": []}
+    ]}
+  ]
+}`
+
+func TestSwayIntegration_FindApplication(t *testing.T) {
+	server := newFakeI3Server(t, recordedSwayTree)
+	w := &SwayIntegration{*server.integration()}
+
+	windows, err := w.Windows()
+	if err != nil {
+		t.Fatalf("Windows() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"foot", "8"},
+		{"slack", "9"},
+		{"org.gnome.TextEditor", "7"},
+		{"general", "9"},
+		{"firefox", ""},
+	}
+	for _, tt := range tests {
+		matcher, err := NewMatcher(config.DefaultApp(tt.name))
+		if err != nil {
+			t.Fatalf("NewMatcher(%s) error = %v", tt.name, err)
+		}
+		if got := matcher.Find(windows); got != tt.want {
+			t.Errorf("Find(%s) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	got, err := w.FindOrStartApplication(config.DefaultApp("foot"))
+	if err != nil {
+		t.Fatalf("FindOrStartApplication() error = %v", err)
+	}
+	if got != "8" {
+		t.Errorf("FindOrStartApplication() = %s, want 8", got)
+	}
+}
+
+func TestSwayIntegration_ScratchpadCommands(t *testing.T) {
+	server := newFakeI3Server(t, recordedSwayTree)
+	w := &SwayIntegration{*server.integration()}
+
+	if got := w.GetFocusedID(); got != "8" {
+		t.Errorf("GetFocusedID() = %s, want 8", got)
+	}
+	if err := w.Hide("8"); err != nil {
+		t.Fatalf("Hide() error = %v", err)
+	}
+	if err := w.Show("7"); err != nil {
+		t.Fatalf("Show() error = %v", err)
+	}
+
+	want := []string{"[con_id=8] move scratchpad", "[con_id=7] scratchpad show"}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.commands) != len(want) || server.commands[0] != want[0] || server.commands[1] != want[1] {
+		t.Errorf("commands = %q, want %q", server.commands, want)
+	}
+}
@@ -0,0 +1,311 @@
+// Package wmtest provides a scriptable wm.WMIntegration for tests that need
+// to exercise window toggling without a running window manager.
+package wmtest
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/hellola/startorswitch/config"
+	"github.com/hellola/startorswitch/wm"
+)
+
+var (
+	_ wm.WMIntegration = (*Fake)(nil)
+	_ wm.WindowLister  = (*Fake)(nil)
+	_ wm.Modifiable    = (*Fake)(nil)
+	_ wm.Padder        = (*Fake)(nil)
+	_ wm.Placer        = (*Fake)(nil)
+	_ wm.Follower      = (*Fake)(nil)
+)
+
+// Call records a single method invocation on a Fake
+type Call struct {
+	Method string
+	NodeID string
+}
+
+// Fake implements wm.WMIntegration in memory. Only nodes registered through
+// SetFocused, SetAlive or AddApp are alive, Show focuses the node like the
+// real backends do and every call is recorded for later inspection.
+type Fake struct {
+	mu      sync.Mutex
+	focused string
+	alive   map[string]bool
+	hidden  map[string]bool
+	apps    map[string]string
+	errors  map[string]error
+	windows map[string]wm.Window
+	mods    map[string]map[wm.Modifier]bool
+	padding int
+	placed  map[string]config.Geometry
+	// followedTo holds the workspace each node was last followed to
+	followedTo map[string]string
+	calls      []Call
+	launched   []config.App
+}
+
+// NewFake creates a Fake with no windows
+func NewFake() *Fake {
+	return &Fake{
+		alive:      make(map[string]bool),
+		hidden:     make(map[string]bool),
+		apps:       make(map[string]string),
+		errors:     make(map[string]error),
+		windows:    make(map[string]wm.Window),
+		mods:       make(map[string]map[wm.Modifier]bool),
+		placed:     make(map[string]config.Geometry),
+		followedTo: make(map[string]string),
+	}
+}
+
+// SetFocused sets the ID returned by GetFocusedID
+func (f *Fake) SetFocused(nodeID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.focused = nodeID
+	f.alive[nodeID] = true
+}
+
+// SetAlive marks a node as alive or dead for StillAlive
+func (f *Fake) SetAlive(nodeID string, alive bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.alive[nodeID] = alive
+}
+
+// AddApp registers the node FindOrStartApplication returns for name
+func (f *Fake) AddApp(name, nodeID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.apps[name] = nodeID
+	f.alive[nodeID] = true
+}
+
+// AddWindow registers a window reported by Windows and marks it alive
+func (f *Fake) AddWindow(window wm.Window) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.windows[window.ID] = window
+	f.alive[window.ID] = true
+}
+
+// FailOn makes every subsequent call to method return err. A nil err clears
+// the failure.
+func (f *Fake) FailOn(method string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err == nil {
+		delete(f.errors, method)
+		return
+	}
+	f.errors[method] = err
+}
+
+// IsHidden reports whether the node was last hidden rather than shown
+func (f *Fake) IsHidden(nodeID string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.hidden[nodeID]
+}
+
+// HasModifier reports whether mod was last switched on for the node
+func (f *Fake) HasModifier(nodeID string, mod wm.Modifier) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.mods[nodeID][mod]
+}
+
+// TopPadding returns the padding last passed to SetTopPadding
+func (f *Fake) TopPadding() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.padding
+}
+
+// Placed returns the geometry the node was last placed with
+func (f *Fake) Placed(nodeID string) (config.Geometry, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	geometry, ok := f.placed[nodeID]
+	return geometry, ok
+}
+
+// FollowedTo returns the workspace the node was last followed to
+func (f *Fake) FollowedTo(nodeID string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.followedTo[nodeID]
+}
+
+// Calls returns a copy of the recorded calls
+func (f *Fake) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// CallsTo returns the node IDs passed to method, in call order
+func (f *Fake) CallsTo(method string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var ids []string
+	for _, c := range f.calls {
+		if c.Method == method {
+			ids = append(ids, c.NodeID)
+		}
+	}
+	return ids
+}
+
+// Launched returns the applications passed to FindOrStartApplication
+func (f *Fake) Launched() []config.App {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]config.App(nil), f.launched...)
+}
+
+// ResetCalls forgets all recorded calls
+func (f *Fake) ResetCalls() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = nil
+}
+
+// record appends a call and returns the configured error for method. The
+// caller must hold f.mu.
+func (f *Fake) record(method, nodeID string) error {
+	f.calls = append(f.calls, Call{Method: method, NodeID: nodeID})
+	return f.errors[method]
+}
+
+func (f *Fake) Show(nodeID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("Show", nodeID); err != nil {
+		return err
+	}
+	f.hidden[nodeID] = false
+	f.focused = nodeID
+	return nil
+}
+
+func (f *Fake) Follow(nodeID, workspace string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("Follow", nodeID); err != nil {
+		return err
+	}
+	f.followedTo[nodeID] = workspace
+	f.hidden[nodeID] = false
+	f.focused = nodeID
+	return nil
+}
+
+func (f *Fake) Hide(nodeID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("Hide", nodeID); err != nil {
+		return err
+	}
+	f.hidden[nodeID] = true
+	if f.focused == nodeID {
+		f.focused = ""
+	}
+	return nil
+}
+
+func (f *Fake) StillAlive(nodeID string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("StillAlive", nodeID)
+	return f.alive[nodeID]
+}
+
+func (f *Fake) Focus(nodeID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("Focus", nodeID); err != nil {
+		return err
+	}
+	f.focused = nodeID
+	return nil
+}
+
+func (f *Fake) IsFocused(nodeID string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.focused == nodeID
+}
+
+func (f *Fake) GetFocusedID() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.focused
+}
+
+func (f *Fake) FindOrStartApplication(app config.App) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("FindOrStartApplication", app.Name); err != nil {
+		return "", err
+	}
+	f.launched = append(f.launched, app)
+	id, ok := f.apps[app.Name]
+	if !ok {
+		return "", fmt.Errorf("failed to start application: %s", app.Name)
+	}
+	return id, nil
+}
+
+// Windows returns the windows registered with AddWindow that are still
+// alive, ordered by ID
+func (f *Fake) Windows() ([]wm.Window, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("Windows", ""); err != nil {
+		return nil, err
+	}
+	var windows []wm.Window
+	for id, window := range f.windows {
+		if f.alive[id] {
+			windows = append(windows, window)
+		}
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i].ID < windows[j].ID })
+	return windows, nil
+}
+
+func (f *Fake) SetModifier(nodeID string, mod wm.Modifier, on bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("SetModifier", nodeID); err != nil {
+		return err
+	}
+	if f.mods[nodeID] == nil {
+		f.mods[nodeID] = make(map[wm.Modifier]bool)
+	}
+	f.mods[nodeID][mod] = on
+	return nil
+}
+
+func (f *Fake) SetTopPadding(pixels int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("SetTopPadding", ""); err != nil {
+		return err
+	}
+	f.padding = pixels
+	return nil
+}
+
+func (f *Fake) Place(nodeID string, geometry config.Geometry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("Place", nodeID); err != nil {
+		return err
+	}
+	f.placed[nodeID] = geometry
+	return nil
+}
@@ -0,0 +1,195 @@
+package wm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+)
+
+// x11 is a lazily opened connection to the X server with helpers for reading
+// ICCCM/EWMH properties and sending client messages to the window manager
+type x11 struct {
+	mu sync.Mutex
+	// display is the X display to connect to, $DISPLAY if empty
+	display string
+	conn    *xgb.Conn
+	root    xproto.Window
+	atoms   map[string]xproto.Atom
+}
+
+// connect opens the X connection on first use
+func (x *x11) connect() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.conn != nil {
+		return nil
+	}
+	conn, err := xgb.NewConnDisplay(x.display)
+	if err != nil {
+		return fmt.Errorf("failed to connect to X server: %v", err)
+	}
+	x.conn = conn
+	x.root = xproto.Setup(conn).DefaultScreen(conn).Root
+	x.atoms = make(map[string]xproto.Atom)
+	return nil
+}
+
+// Close closes the X connection, if any
+func (x *x11) Close() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.conn != nil {
+		x.conn.Close()
+		x.conn = nil
+	}
+}
+
+// atom interns name, caching the result for the lifetime of the connection
+func (x *x11) atom(name string) (xproto.Atom, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if atom, ok := x.atoms[name]; ok {
+		return atom, nil
+	}
+	reply, err := xproto.InternAtom(x.conn, false, uint16(len(name)), name).Reply()
+	if err != nil {
+		return 0, err
+	}
+	x.atoms[name] = reply.Atom
+	return reply.Atom, nil
+}
+
+// property returns the raw value of a window property
+func (x *x11) property(win xproto.Window, name string) ([]byte, error) {
+	atom, err := x.atom(name)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := xproto.GetProperty(x.conn, false, win, atom, xproto.GetPropertyTypeAny, 0, 1<<16).Reply()
+	if err != nil {
+		return nil, err
+	}
+	return reply.Value, nil
+}
+
+// cardinals reads a property holding a list of 32 bit values such as
+// CARDINAL or WINDOW
+func (x *x11) cardinals(win xproto.Window, name string) ([]uint32, error) {
+	value, err := x.property(win, name)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]uint32, len(value)/4)
+	for i := range values {
+		values[i] = binary.LittleEndian.Uint32(value[i*4:])
+	}
+	return values, nil
+}
+
+// cardinal reads the first value of a 32 bit property
+func (x *x11) cardinal(win xproto.Window, name string) (uint32, bool) {
+	values, err := x.cardinals(win, name)
+	if err != nil || len(values) == 0 {
+		return 0, false
+	}
+	return values[0], true
+}
+
+// text reads a string property, dropping any trailing NUL
+func (x *x11) text(win xproto.Window, name string) string {
+	value, err := x.property(win, name)
+	if err != nil {
+		return ""
+	}
+	return string(bytes.TrimRight(value, "\x00"))
+}
+
+// title returns _NET_WM_NAME, falling back to WM_NAME
+func (x *x11) title(win xproto.Window) string {
+	if title := x.text(win, "_NET_WM_NAME"); title != "" {
+		return title
+	}
+	return x.text(win, "WM_NAME")
+}
+
+// class returns the instance and class parts of WM_CLASS
+func (x *x11) class(win xproto.Window) (string, string) {
+	value, err := x.property(win, "WM_CLASS")
+	if err != nil {
+		return "", ""
+	}
+	parts := bytes.Split(bytes.TrimRight(value, "\x00"), []byte{0})
+	if len(parts) < 2 {
+		return string(parts[0]), ""
+	}
+	return string(parts[0]), string(parts[1])
+}
+
+// info collects the properties used to match win against application rules
+func (x *x11) info(win xproto.Window) Window {
+	instance, class := x.class(win)
+	pid, _ := x.cardinal(win, "_NET_WM_PID")
+	return Window{
+		ID:        formatWindowID(win),
+		Class:     class,
+		Instance:  instance,
+		Title:     x.title(win),
+		Role:      x.text(win, "WM_WINDOW_ROLE"),
+		PID:       int(pid),
+		Workspace: x.desktop(win),
+	}
+}
+
+// desktop returns the name of the desktop win is on according to
+// _NET_WM_DESKTOP and _NET_DESKTOP_NAMES, falling back to its number
+func (x *x11) desktop(win xproto.Window) string {
+	index, ok := x.cardinal(win, "_NET_WM_DESKTOP")
+	if !ok || index == ewmhAllDesktops {
+		return ""
+	}
+	names := strings.Split(x.text(x.root, "_NET_DESKTOP_NAMES"), "\x00")
+	if int(index) < len(names) && names[index] != "" {
+		return names[index]
+	}
+	return strconv.FormatUint(uint64(index), 10)
+}
+
+// clientMessage sends a 32 bit client message about win to the root window,
+// which is how EWMH pagers ask the window manager to act on a window
+func (x *x11) clientMessage(win xproto.Window, name string, data ...uint32) error {
+	atom, err := x.atom(name)
+	if err != nil {
+		return err
+	}
+	for len(data) < 5 {
+		data = append(data, 0)
+	}
+	event := xproto.ClientMessageEvent{
+		Format: 32,
+		Window: win,
+		Type:   atom,
+		Data:   xproto.ClientMessageDataUnionData32New(data),
+	}
+	mask := uint32(xproto.EventMaskSubstructureRedirect | xproto.EventMaskSubstructureNotify)
+	return xproto.SendEvent(x.conn, false, x.root, mask, string(event.Bytes())).Check()
+}
+
+// formatWindowID formats an X window ID the way bspc prints node IDs
+func formatWindowID(win xproto.Window) string {
+	return fmt.Sprintf("0x%08X", uint32(win))
+}
+
+// parseWindowID parses a window ID in hex (0x...) or decimal notation
+func parseWindowID(id string) (xproto.Window, error) {
+	value, err := strconv.ParseUint(id, 0, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid window ID %q: %v", id, err)
+	}
+	return xproto.Window(value), nil
+}